@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// cfPrefixes Cloudflare 公布的 IP 段（https://www.cloudflare.com/ips/），-cfurl 刷新失败时使用
+var cfPrefixes = []string{
+	"173.245.48.0/20",
+	"103.21.244.0/22",
+	"103.22.200.0/22",
+	"103.31.4.0/22",
+	"141.101.64.0/18",
+	"108.162.192.0/18",
+	"190.93.240.0/20",
+	"188.114.96.0/20",
+	"197.234.240.0/22",
+	"198.41.128.0/17",
+	"162.158.0.0/15",
+	"104.16.0.0/13",
+	"104.24.0.0/14",
+	"172.64.0.0/13",
+	"131.0.72.0/22",
+	"2400:cb00::/32",
+	"2606:4700::/32",
+	"2803:f800::/32",
+	"2405:b500::/32",
+	"2405:8100::/32",
+	"2a06:98c0::/29",
+	"2c0f:f248::/32",
+}
+
+// genSource 生成模式下目标的来源名称
+const genSource = "内置Cloudflare段"
+
+// gen6PrefixBits 生成 IPv6 目标时随机抽取的子网前缀长度
+const gen6PrefixBits = 48
+
+// parseGenFamilies 解析 -gen 指定的地址族：4、6 或 4,6
+func parseGenFamilies(spec string) (v4, v6 bool, err error) {
+	for _, f := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(f) {
+		case "4":
+			v4 = true
+		case "6":
+			v6 = true
+		case "":
+		default:
+			return false, false, fmt.Errorf("不支持的生成模式: %s，可选 4、6 或 4,6", spec)
+		}
+	}
+	return v4, v6, nil
+}
+
+// cfRangeCache 首次加载的 Cloudflare IP 段，之后的调用直接复用，不再重复下载 -cfurl
+var cfRangeCache []ipRange
+
+// cfRanges 返回 Cloudflare IP 段：指定 -cfurl 时从该地址（或本地文件）刷新，失败或为空时使用内置列表。
+// 只在首次调用时加载，调用方不应修改返回的切片
+func cfRanges() []ipRange {
+	if cfRangeCache == nil {
+		cfRangeCache = loadCFRanges()
+	}
+	return cfRangeCache
+}
+
+// loadCFRanges 加载 Cloudflare IP 段
+func loadCFRanges() []ipRange {
+	if *cfURL != "" {
+		var ranges []ipRange
+		for _, source := range strings.Split(*cfURL, ",") {
+			source = strings.TrimSpace(source)
+			if source == "" {
+				continue
+			}
+			localPath := source
+			if isRemoteSource(source) {
+				var err error
+				if localPath, err = fetchRemoteSource(source); err != nil {
+					fmt.Printf("刷新Cloudflare IP段 %s 失败: %v\n", source, err)
+					continue
+				}
+			}
+			rs, _, err := readExcludeFile(localPath)
+			if err != nil {
+				fmt.Printf("读取Cloudflare IP段 %s 时出错: %v\n", source, err)
+				continue
+			}
+			ranges = append(ranges, rs...)
+		}
+		if len(ranges) > 0 {
+			fmt.Printf("已从 %s 刷新Cloudflare IP段，共 %d 个\n", *cfURL, len(ranges))
+			return ranges
+		}
+		fmt.Println("未能刷新Cloudflare IP段，使用内置列表")
+	}
+
+	ranges := make([]ipRange, 0, len(cfPrefixes))
+	for _, spec := range cfPrefixes {
+		start, end, _ := parseIPRange(spec)
+		ranges = append(ranges, ipRange{start: start, end: end, text: spec})
+	}
+	return ranges
+}
+
+// generateTargets 从 Cloudflare IP 段生成候选目标：IPv4 按 -sample4 子网抽样，IPv6 随机抽取 -gen6 个 /48，
+// 每个子网取 -samplek 个地址，与 -genports 中的每个端口组合。标签为所属的 IP 段
+func generateTargets(emit func(Target)) (int, error) {
+	v4, v6, err := parseGenFamilies(*genFamilies)
+	if err != nil {
+		return 0, err
+	}
+	genPortList, err := parsePortSpec(*genPorts)
+	if err != nil {
+		return 0, fmt.Errorf("-genports 无效: %w", err)
+	}
+
+	parseDiag.startFile(genSource)
+	add := func(t Target) {
+		t.Source = genSource
+		parseDiag.target(t)
+		emit(t)
+	}
+
+	var ranges4, ranges6 []ipRange
+	for _, r := range cfRanges() {
+		if r.start.Is4() {
+			ranges4 = append(ranges4, r)
+		} else {
+			ranges6 = append(ranges6, r)
+		}
+	}
+
+	count := 0
+	for _, port := range genPortList {
+		if v4 {
+			for _, r := range ranges4 {
+				r.port, r.tag = port, r.text
+				count += sampleRange(r, add)
+			}
+		}
+		if v6 {
+			count += generate6(ranges6, port, add)
+		}
+	}
+	fmt.Printf("从Cloudflare IP段生成候选目标 %d 个 (端口 %s)\n", count, formatPorts(genPortList))
+	return count, nil
+}
+
+// generate6 在所有 IPv6 段的 /48 中按大小加权随机抽取 -gen6 个不重复的 /48，每个 /48 随机取 -samplek 个地址
+func generate6(ranges []ipRange, port int, emit func(Target)) int {
+	total := uint64(0)
+	sizes := make([]uint64, len(ranges))
+	for i, r := range ranges {
+		sizes[i] = subnetCount(r, gen6PrefixBits)
+		total += sizes[i]
+	}
+	want := uint64(*gen6Count)
+	if want > total {
+		want = total
+	}
+
+	rng := getSampleRng()
+	seen := make(map[netip.Addr]bool, want)
+	count := 0
+	for uint64(len(seen)) < want {
+		// 先按子网数量选出 IP 段，再选出其中的 /48
+		n := rng.Uint64N(total)
+		i := 0
+		for n >= sizes[i] {
+			n -= sizes[i]
+			i++
+		}
+		r := ranges[i]
+		first, _ := r.start.Prefix(gen6PrefixBits)
+		offHi, offLo := shl128(0, n, uint(128-gen6PrefixBits))
+		subnet := addrAdd(first.Addr(), offHi, offLo)
+		if seen[subnet] {
+			continue
+		}
+		seen[subnet] = true
+		prefix := netip.PrefixFrom(subnet, gen6PrefixBits)
+		sizeHi, sizeLo := rangeSpan(subnet, lastAddr(prefix))
+		for k := 0; k < *sampleK; k++ {
+			offHi, offLo := randUint128(rng, sizeHi, sizeLo)
+			emit(ipRange{port: port, tag: r.text}.target(addrAdd(subnet, offHi, offLo)))
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// withCFRanges 清空已加载的 Cloudflare IP 段，测试结束后恢复缓存和生成相关参数
+func withCFRanges(t *testing.T) {
+	t.Helper()
+	cache, url, families, ports, count := cfRangeCache, *cfURL, *genFamilies, *genPorts, *gen6Count
+	t.Cleanup(func() {
+		cfRangeCache, *cfURL, *genFamilies, *genPorts, *gen6Count = cache, url, families, ports, count
+	})
+	cfRangeCache, *cfURL = nil, ""
+}
+
+func rangeTexts(ranges []ipRange) []string {
+	var texts []string
+	for _, r := range ranges {
+		texts = append(texts, r.text)
+	}
+	return texts
+}
+
+func TestCFPrefixes(t *testing.T) {
+	withCFRanges(t)
+	ranges := cfRanges()
+	if !slices.Equal(rangeTexts(ranges), cfPrefixes) {
+		t.Fatalf("built-in ranges = %v, want %v", rangeTexts(ranges), cfPrefixes)
+	}
+	v4 := 0
+	for i, r := range ranges {
+		prefix, err := netip.ParsePrefix(cfPrefixes[i])
+		if err != nil || prefix != prefix.Masked() || r.start != prefix.Addr() || r.end != lastAddr(prefix) {
+			t.Errorf("built-in prefix %s parsed as %s-%s (%v)", cfPrefixes[i], r.start, r.end, err)
+		}
+		if r.start.Is4() {
+			v4++
+		}
+		for _, other := range ranges[:i] {
+			if r.start.BitLen() == other.start.BitLen() && !r.end.Less(other.start) && !other.end.Less(r.start) {
+				t.Errorf("built-in prefixes %s and %s overlap", r.text, other.text)
+			}
+		}
+	}
+	if v4 == 0 || v4 == len(ranges) {
+		t.Errorf("built-in list has %d IPv4 of %d prefixes, want both families", v4, len(ranges))
+	}
+}
+
+func TestCFRangesRefresh(t *testing.T) {
+	withCFRanges(t)
+	withRemoteFlags(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ips-v4":
+			w.Write([]byte("104.16.0.0/13\n104.24.0.0/14\n"))
+		case "/ips-v6":
+			w.Write([]byte("2606:4700::/32\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	local := filepath.Join(t.TempDir(), "extra.txt")
+	if err := os.WriteFile(local, []byte("# extra\n172.64.0.0/13\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 远程地址和本地文件合并，失败的来源跳过
+	*cfURL = server.URL + "/ips-v4, " + server.URL + "/missing," + server.URL + "/ips-v6," + local
+	want := []string{"104.16.0.0/13", "104.24.0.0/14", "2606:4700::/32", "172.64.0.0/13"}
+	if got := rangeTexts(loadCFRanges()); !slices.Equal(got, want) {
+		t.Errorf("loadCFRanges() = %v, want %v", got, want)
+	}
+
+	// 全部失败或内容为空时使用内置列表
+	empty := filepath.Join(t.TempDir(), "empty.txt")
+	os.WriteFile(empty, nil, 0644)
+	for _, spec := range []string{server.URL + "/missing", filepath.Join(t.TempDir(), "none.txt"), empty} {
+		*cfURL = spec
+		if got := rangeTexts(loadCFRanges()); !slices.Equal(got, cfPrefixes) {
+			t.Errorf("loadCFRanges(%s) = %v, want the built-in list", spec, got)
+		}
+	}
+}
+
+func TestParseGenFamilies(t *testing.T) {
+	tests := []struct {
+		spec    string
+		v4, v6  bool
+		wantErr bool
+	}{
+		{spec: "4", v4: true},
+		{spec: "6", v6: true},
+		{spec: "4,6", v4: true, v6: true},
+		{spec: " 6 , 4 ,", v4: true, v6: true},
+		{spec: "", v4: false},
+		{spec: "4,5", wantErr: true},
+		{spec: "ipv4", wantErr: true},
+	}
+	for _, tt := range tests {
+		v4, v6, err := parseGenFamilies(tt.spec)
+		if (err != nil) != tt.wantErr || v4 != tt.v4 || v6 != tt.v6 {
+			t.Errorf("parseGenFamilies(%q) = %v, %v, %v", tt.spec, v4, v6, err)
+		}
+	}
+}
+
+// TestGenerateTargets 生成的地址都在已加载的 IP 段内，数量符合 -sample4、-gen6、-samplek 和 -genports
+func TestGenerateTargets(t *testing.T) {
+	withCFRanges(t)
+	withSampleFlags(t, "random", 2, 24, 0, 1)
+	cfRangeCache = []ipRange{testRange(t, "104.16.0.0/22", 0), testRange(t, "198.41.128.0/24", 0), testRange(t, "2606:4700::/46", 0)}
+
+	tests := []struct {
+		families string
+		gen6     int
+		want     int
+		want48   int // 每个端口抽到的 /48 数量
+	}{
+		// 5 个 /24 和 3 个 /48，每个取 2 个地址，两个端口
+		{families: "4,6", gen6: 3, want: (5 + 3) * 2 * 2, want48: 3},
+		{families: "4", gen6: 3, want: 5 * 2 * 2},
+		// -gen6 超过可用的 /48 数量时取全部 4 个
+		{families: "6", gen6: 10, want: 4 * 2 * 2, want48: 4},
+	}
+	for _, tt := range tests {
+		*genFamilies, *genPorts, *gen6Count = tt.families, "443,2053", tt.gen6
+		var targets []Target
+		count, err := generateTargets(func(target Target) {
+			targets = append(targets, target)
+		})
+		if err != nil || count != tt.want || len(targets) != tt.want {
+			t.Errorf("-gen %s: generateTargets() = %d (%d emitted), %v, want %d", tt.families, count, len(targets), err, tt.want)
+			continue
+		}
+
+		seen := make(map[string]bool)
+		subnets := map[int]map[netip.Prefix]bool{443: {}, 2053: {}}
+		for _, target := range targets {
+			addr := target.AddrPort.Addr()
+			in := false
+			for _, r := range cfRangeCache {
+				if !addr.Less(r.start) && !r.end.Less(addr) {
+					in = r.text == target.Tag
+				}
+			}
+			if !in || target.Source != genSource || seen[target.Key()] {
+				t.Errorf("-gen %s: target %s tag %q source %q outside its range or repeated", tt.families, target, target.Tag, target.Source)
+			}
+			seen[target.Key()] = true
+			if addr.Is6() {
+				prefix, _ := addr.Prefix(gen6PrefixBits)
+				subnets[target.Port()][prefix] = true
+			}
+		}
+		for port, set := range subnets {
+			if len(set) != tt.want48 {
+				t.Errorf("-gen %s: port %d used %d /48s, want %d", tt.families, port, len(set), tt.want48)
+			}
+		}
+	}
+
+	*genFamilies, *genPorts = "4", "0"
+	if _, err := generateTargets(func(Target) {}); err == nil {
+		t.Error("generateTargets() accepted an invalid -genports")
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// clashProxiesPattern 匹配 Clash/Mihomo 配置或 proxy-provider 中顶层的 proxies 键
+var clashProxiesPattern = regexp.MustCompile(`(?m)^proxies:\s*(#.*)?$`)
+
+// looksLikeConfig 根据扩展名或开头内容判断文件可能是代理配置，需要整体读取解析
+func looksLikeConfig(filePath string, head []byte) bool {
+	switch sourceExt(filePath) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	trimmed := bytes.TrimSpace(head)
+	return bytes.HasPrefix(trimmed, []byte("{")) && bytes.Contains(head, []byte(`"outbounds"`)) ||
+		clashProxiesPattern.Match(head) || uciSectionPattern.Match(head)
+}
+
+// parseProxyConfig 按内容识别 Clash/Mihomo YAML、sing-box JSON、Xray JSON 配置和 OpenWrt 代理插件的 UCI 配置，
+// 提取每个出站的服务器、端口、SNI 和传输方式，format 为识别出的配置类型
+func parseProxyConfig(filePath string, content []byte) (targets []Target, format string, ok bool) {
+	if targets, format, ok := parseUCIConfig(filePath, content); ok {
+		return targets, format, true
+	}
+	trimmed := bytes.TrimSpace(content)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		var conf struct {
+			Outbounds []map[string]any `json:"outbounds"`
+		}
+		if err := json.Unmarshal(trimmed, &conf); err != nil || conf.Outbounds == nil {
+			return nil, "", false
+		}
+		for _, outbound := range conf.Outbounds {
+			var nodes []*shareNode
+			if _, isXray := outbound["protocol"]; isXray {
+				format = "Xray"
+				nodes = xrayOutboundNodes(outbound)
+			} else {
+				format = "sing-box"
+				nodes = singBoxOutboundNodes(outbound)
+			}
+			for _, node := range nodes {
+				targets = appendNodeTarget(targets, node)
+			}
+		}
+		return targets, format, true
+	}
+
+	if !clashProxiesPattern.Match(content) {
+		return nil, "", false
+	}
+	var conf struct {
+		Proxies []map[string]any `yaml:"proxies"`
+	}
+	if err := yaml.Unmarshal(content, &conf); err != nil {
+		fmt.Printf("Clash配置解析失败: %v\n", err)
+		return nil, "", false
+	}
+	for _, proxy := range conf.Proxies {
+		if node := clashProxyNode(proxy); node != nil {
+			targets = appendNodeTarget(targets, node)
+		}
+	}
+	return targets, "Clash/Mihomo", true
+}
+
+// appendNodeTarget 将节点转换为目标追加到列表，地址无效的节点被跳过
+func appendNodeTarget(targets []Target, node *shareNode) []Target {
+	t, err := node.target()
+	if err != nil {
+		fmt.Printf("跳过无效节点(%v): %s\n", err, node.name)
+		return targets
+	}
+	return append(targets, t)
+}
+
+// clashProxyNode 将 Clash/Mihomo 的 proxies 条目转换为节点
+func clashProxyNode(proxy map[string]any) *shareNode {
+	node := &shareNode{
+		scheme:  mapString(proxy, "type"),
+		name:    mapString(proxy, "name"),
+		server:  mapString(proxy, "server"),
+		port:    mapPort(proxy, "port"),
+		sni:     firstNonEmpty(mapString(proxy, "servername"), mapString(proxy, "sni")),
+		network: mapString(proxy, "network"),
+	}
+	if node.port == 0 {
+		// hysteria2 跳跃端口写在 ports 中
+		node.port = mapPort(proxy, "ports")
+	}
+	if b, _ := proxy["tls"].(bool); b {
+		node.security = "tls"
+	}
+	if _, ok := proxy["reality-opts"]; ok {
+		node.security = "reality"
+	}
+	if opts := mapMap(proxy, "ws-opts"); opts != nil {
+		node.path = mapString(opts, "path")
+		node.host = mapString(mapMap(opts, "headers"), "Host")
+	}
+	if opts := mapMap(proxy, "h2-opts"); opts != nil {
+		node.path = mapString(opts, "path")
+		if hosts, ok := opts["host"].([]any); ok && len(hosts) > 0 {
+			node.host = fmt.Sprint(hosts[0])
+		}
+	}
+	if opts := mapMap(proxy, "grpc-opts"); opts != nil {
+		node.path = mapString(opts, "grpc-service-name")
+	}
+	if opts := mapMap(proxy, "plugin-opts"); opts != nil {
+		node.host = mapString(opts, "host")
+		node.path = mapString(opts, "path")
+		if node.sni == "" {
+			node.sni = node.host
+		}
+	}
+	if node.server == "" || node.port == 0 {
+		fmt.Printf("跳过无效节点(缺少服务器或端口): %s\n", node.name)
+		return nil
+	}
+	return node
+}
+
+// singBoxOutboundNodes 将 sing-box 出站转换为节点，direct/block/selector 等无服务器的出站被忽略
+func singBoxOutboundNodes(outbound map[string]any) []*shareNode {
+	server := mapString(outbound, "server")
+	port := mapPort(outbound, "server_port")
+	if server == "" || port == 0 {
+		return nil
+	}
+	node := &shareNode{
+		scheme: mapString(outbound, "type"),
+		name:   mapString(outbound, "tag"),
+		server: server,
+		port:   port,
+	}
+	if tls := mapMap(outbound, "tls"); tls != nil {
+		if enabled, _ := tls["enabled"].(bool); enabled {
+			node.security = "tls"
+			if reality := mapMap(tls, "reality"); reality != nil {
+				node.security = "reality"
+			}
+		}
+		node.sni = mapString(tls, "server_name")
+	}
+	if transport := mapMap(outbound, "transport"); transport != nil {
+		node.network = mapString(transport, "type")
+		node.path = firstNonEmpty(mapString(transport, "path"), mapString(transport, "service_name"))
+		node.host = mapString(mapMap(transport, "headers"), "Host")
+		if hosts, ok := transport["host"].([]any); ok && len(hosts) > 0 {
+			node.host = fmt.Sprint(hosts[0])
+		} else if host := mapString(transport, "host"); host != "" {
+			node.host = host
+		}
+	}
+	return []*shareNode{node}
+}
+
+// xrayOutboundNodes 将 Xray 出站转换为节点，vnext/servers 中的每个服务器各生成一个节点
+func xrayOutboundNodes(outbound map[string]any) []*shareNode {
+	settings := mapMap(outbound, "settings")
+	var servers []any
+	if vnext, ok := settings["vnext"].([]any); ok {
+		servers = vnext
+	} else if list, ok := settings["servers"].([]any); ok {
+		servers = list
+	}
+
+	stream := mapMap(outbound, "streamSettings")
+	template := shareNode{
+		scheme:   mapString(outbound, "protocol"),
+		name:     mapString(outbound, "tag"),
+		network:  mapString(stream, "network"),
+		security: mapString(stream, "security"),
+	}
+	// 只读取与 security、network 对应的 <类型>Settings，配置中残留的其他类型设置不生效
+	if template.security != "" && template.security != "none" {
+		template.sni = mapString(mapMap(stream, template.security+"Settings"), "serverName")
+	}
+	switch template.network {
+	case "ws", "httpupgrade", "xhttp", "splithttp":
+		s := mapMap(stream, template.network+"Settings")
+		template.path = mapString(s, "path")
+		template.host = firstNonEmpty(mapString(s, "host"), mapString(mapMap(s, "headers"), "Host"))
+	case "grpc":
+		template.path = mapString(mapMap(stream, "grpcSettings"), "serviceName")
+	}
+
+	var nodes []*shareNode
+	for _, item := range servers {
+		server, _ := item.(map[string]any)
+		node := template
+		node.server = mapString(server, "address")
+		node.port = mapPort(server, "port")
+		if node.server == "" || node.port == 0 {
+			continue
+		}
+		nodes = append(nodes, &node)
+	}
+	return nodes
+}
+
+// mapString 读取字符串字段，不存在或类型不符时返回空
+func mapString(m map[string]any, key string) string {
+	return anyString(m[key])
+}
+
+// anyString 将 JSON/YAML 中的字符串或数字值转换为字符串，其他类型返回空
+func anyString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	}
+	return ""
+}
+
+// mapMap 读取嵌套对象字段
+func mapMap(m map[string]any, key string) map[string]any {
+	v, _ := m[key].(map[string]any)
+	return v
+}
+
+// mapPort 读取端口字段，兼容数字、字符串以及 "443,8443-8450" 形式（取第一个）
+func mapPort(m map[string]any, key string) int {
+	s := mapString(m, key)
+	if idx := strings.IndexAny(s, ",-"); idx != -1 {
+		s = s[:idx]
+	}
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || port <= 0 || port >= 65536 {
+		return 0
+	}
+	return port
+}
@@ -0,0 +1,105 @@
+package main
+
+import "testing"
+
+// configTarget 测试中关注的目标字段
+type configTarget struct {
+	addr, sni, tag, host, path, network, security string
+}
+
+// configTargets 提取目标中用于比较的字段
+func configTargets(targets []Target) []configTarget {
+	var got []configTarget
+	for _, t := range targets {
+		got = append(got, configTarget{t.String(), t.SNI, t.Tag, t.meta("host"), t.meta("path"), t.meta("type"), t.meta("security")})
+	}
+	return got
+}
+
+func TestParseProxyConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		format  string
+		want    []configTarget
+	}{
+		{
+			name: "xray uses the settings matching security and network",
+			path: "config.json",
+			content: `{"outbounds": [
+				{"tag": "tls-ws", "protocol": "vless",
+				 "settings": {"vnext": [{"address": "104.16.1.2", "port": 443}, {"address": "104.16.1.3", "port": 2053}]},
+				 "streamSettings": {"network": "ws", "security": "tls",
+				   "tlsSettings": {"serverName": "tls.example.com"},
+				   "realitySettings": {"serverName": "stale.example.com"},
+				   "wsSettings": {"path": "/ws", "headers": {"Host": "ws.example.com"}},
+				   "grpcSettings": {"serviceName": "stale"}}},
+				{"tag": "reality", "protocol": "vless",
+				 "settings": {"vnext": [{"address": "1.2.3.4", "port": "8443"}]},
+				 "streamSettings": {"network": "grpc", "security": "reality",
+				   "tlsSettings": {"serverName": "stale.example.com"},
+				   "realitySettings": {"serverName": "www.example.com"},
+				   "grpcSettings": {"serviceName": "svc"}}},
+				{"tag": "plain", "protocol": "trojan",
+				 "settings": {"servers": [{"address": "5.6.7.8", "port": 80}]},
+				 "streamSettings": {"network": "tcp", "security": "none", "tlsSettings": {"serverName": "stale.example.com"}}},
+				{"tag": "direct", "protocol": "freedom"}
+			]}`,
+			format: "Xray",
+			want: []configTarget{
+				{"104.16.1.2:443", "tls.example.com", "tls-ws", "ws.example.com", "/ws", "ws", "tls"},
+				{"104.16.1.3:2053", "tls.example.com", "tls-ws", "ws.example.com", "/ws", "ws", "tls"},
+				{"1.2.3.4:8443", "www.example.com", "reality", "", "svc", "grpc", "reality"},
+				{"5.6.7.8:80", "", "plain", "", "", "tcp", "none"},
+			},
+		},
+		{
+			name: "sing-box",
+			path: "sing-box.json",
+			content: `{"outbounds": [
+				{"type": "vmess", "tag": "sb", "server": "104.16.1.2", "server_port": 2083,
+				 "tls": {"enabled": true, "server_name": "sb.example.com"},
+				 "transport": {"type": "ws", "path": "/sb", "headers": {"Host": "h.example.com"}}},
+				{"type": "direct", "tag": "direct"}
+			]}`,
+			format: "sing-box",
+			want:   []configTarget{{"104.16.1.2:2083", "sb.example.com", "sb", "h.example.com", "/sb", "ws", "tls"}},
+		},
+		{
+			name: "clash",
+			path: "clash.yaml",
+			content: `proxies:
+  - {name: "c1", type: vmess, server: 104.16.1.2, port: 8443, tls: true, servername: c.example.com,
+     network: ws, ws-opts: {path: /c, headers: {Host: ch.example.com}}}
+  - name: hy
+    type: hysteria2
+    server: 1.2.3.4
+    ports: 20000-20010
+    sni: hy.example.com
+`,
+			format: "Clash/Mihomo",
+			want: []configTarget{
+				{"104.16.1.2:8443", "c.example.com", "c1", "ch.example.com", "/c", "ws", "tls"},
+				{"1.2.3.4:20000", "hy.example.com", "hy", "", "", "", ""},
+			},
+		},
+	}
+	for _, tt := range tests {
+		targets, format, ok := parseProxyConfig(tt.path, []byte(tt.content))
+		if !ok || format != tt.format {
+			t.Errorf("%s: parseProxyConfig() format = %q, ok = %v, want %q", tt.name, format, ok, tt.format)
+			continue
+		}
+		got := configTargets(targets)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d targets %+v, want %d", tt.name, len(got), got, len(tt.want))
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: target %d = %+v, want %+v", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// csvColumns 记录 CSV 中各字段所在的列，-1 表示不存在
+type csvColumns struct {
+	ip, port, latency, speed, colo, domain, node int
+}
+
+// csvHeaderNames 各字段可识别的列名（已规范化），包括本程序的中英文输出、CloudflareST 的输出和通用的 ip/port
+var csvHeaderNames = map[string][]string{
+	"ip":      {"ip地址", "ip", "ipaddress", "ipaddr", "address", "addr", "host", "地址"},
+	"port":    {"端口", "port"},
+	"latency": {"网络延迟", "平均延迟", "延迟", "latency", "avglatency", "averagelatency", "delay"},
+	"speed":   {"下载速度mb/s", "下载速度", "downloadspeedmb/s", "downloadspeed", "speedmb/s", "speed"},
+	"colo":    {"数据中心", "地区码", "datacenter", "colo"},
+	"domain":  {"域名", "domain"},
+	"node":    {"标签", "节点", "tag", "node", "name"},
+}
+
+// normalizeCSVHeader 规范化列名：去掉 BOM、空白、括号、下划线和连字符并转为小写，
+// 使 "下载速度 (MB/s)"、"Download Speed MB/s"、"ip_address" 等写法可以统一匹配
+func normalizeCSVHeader(name string) string {
+	name = strings.TrimPrefix(name, "\ufeff")
+	name = strings.ToLower(name)
+	return strings.NewReplacer(" ", "", "\t", "", "(", "", ")", "", "（", "", "）", "", "_", "", "-", "").Replace(name)
+}
+
+// detectCSVColumns 按列名识别标题行，至少要找到 IP 列才认为是标题行
+func detectCSVColumns(header []string) (csvColumns, bool) {
+	cols := csvColumns{ip: -1, port: -1, latency: -1, speed: -1, colo: -1, domain: -1, node: -1}
+	fields := map[string]*int{
+		"ip": &cols.ip, "port": &cols.port, "latency": &cols.latency, "speed": &cols.speed,
+		"colo": &cols.colo, "domain": &cols.domain, "node": &cols.node,
+	}
+	for i, name := range header {
+		name = normalizeCSVHeader(name)
+		for field, names := range csvHeaderNames {
+			if *fields[field] != -1 {
+				continue
+			}
+			for _, n := range names {
+				if name == n {
+					*fields[field] = i
+				}
+			}
+		}
+	}
+	return cols, cols.ip != -1
+}
+
+// csvColumnsFor 根据第一行判断 CSV 的列布局，hasHeader 表示第一行是标题行。
+// 无法识别标题且第一列不是 IP 时，按原有约定跳过第一行，取第1列为IP、第2列为端口
+func csvColumnsFor(first []string) (cols csvColumns, hasHeader bool) {
+	if cols, ok := detectCSVColumns(first); ok {
+		return cols, true
+	}
+	cols = csvColumns{ip: 0, port: 1, latency: -1, speed: -1, colo: -1, domain: -1, node: -1}
+	if len(first) > 0 {
+		if _, err := netip.ParseAddr(strings.Trim(strings.TrimSpace(first[0]), "[]")); err == nil {
+			return cols, false
+		}
+	}
+	return cols, true
+}
+
+// csvRowTarget 按列布局将一行转换为目标，失败时返回跳过原因。
+// 没有端口列时默认 443（如 CloudflareST 的结果）；重测模式下附带上次的延迟、速度和数据中心
+func csvRowTarget(record []string, cols csvColumns) (t Target, reason string) {
+	get := func(i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	ipAddr := get(cols.ip)
+	if ipAddr == "" {
+		return t, "IP为空"
+	}
+	port := 443
+	if cols.port != -1 {
+		portStr := get(cols.port)
+		if portStr == "" {
+			return t, "端口为空"
+		}
+		p, err := strconv.Atoi(portStr)
+		if err != nil || p <= 0 || p >= 65536 {
+			return t, "端口无效"
+		}
+		port = p
+	}
+
+	t, err := newTarget(ipAddr, port)
+	if err != nil {
+		return t, err.Error()
+	}
+	if domain := get(cols.domain); domain != "" {
+		t.Hostname = domain
+	}
+	t.Tag = get(cols.node)
+	if *retestFile != "" {
+		t.setMeta("prev_latency", get(cols.latency))
+		t.setMeta("prev_speed", get(cols.speed))
+		t.setMeta("prev_colo", get(cols.colo))
+	}
+	return t, ""
+}
+
+// readCSVTargets 逐行读取 CSV，按第一行识别标题和列布局，每行有效数据调用一次 add。
+// 第一行中制表符多于逗号时按制表符分隔；格式错误的行被跳过，不影响其余各行
+func readCSVTargets(input *bufio.Reader, add func(Target)) error {
+	firstLine, _ := input.Peek(4096)
+	if idx := bytes.IndexByte(firstLine, '\n'); idx != -1 {
+		firstLine = firstLine[:idx]
+	}
+	reader := csv.NewReader(input)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	if bytes.Count(firstLine, []byte("\t")) > bytes.Count(firstLine, []byte(",")) {
+		reader.Comma = '\t'
+	}
+	defer parseDiag.end()
+
+	var cols csvColumns
+	for first := true; ; {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			parseDiag.begin(parseErr.Line, "")
+			skipLine(parseErr.Err.Error(), fmt.Sprintf("第 %d 行", parseErr.Line))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+		if first {
+			first = false
+			// 去掉UTF-8 BOM，按列名识别标题行（本程序中英文输出、CloudflareST 输出及通用 ip/port）
+			record[0] = strings.TrimPrefix(record[0], "\ufeff")
+			var hasHeader bool
+			if cols, hasHeader = csvColumnsFor(record); hasHeader {
+				continue
+			}
+		}
+		parseDiag.begin(line, strings.Join(record, ","))
+		parseDiag.match(formatCSV)
+		target, reason := csvRowTarget(record, cols)
+		if reason != "" {
+			parseDiag.reject(reason)
+			continue
+		}
+		add(target)
+	}
+}
+
+// parseLatencyMs 解析 "123 ms"、"123.45" 形式的延迟，单位毫秒
+func parseLatencyMs(s string) (float64, bool) {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "ms"))
+	v, err := strconv.ParseFloat(s, 64)
+	return v, err == nil
+}
+
+// retestColumns 生成重测模式下追加的列：上次延迟、延迟变化、[上次速度、速度变化、]上次数据中心、数据中心是否变化
+func retestColumns(res speedtestresult, withSpeed bool) []string {
+	r := res.result
+	prevLatency, prevSpeed, prevColo := r.target.meta("prev_latency"), r.target.meta("prev_speed"), r.target.meta("prev_colo")
+	latencyDelta := ""
+	if prev, ok := parseLatencyMs(prevLatency); ok {
+		latencyDelta = fmt.Sprintf("%+.0f ms", float64(r.tcpDuration.Milliseconds())-prev)
+	}
+	cols := []string{prevLatency, latencyDelta}
+	if withSpeed {
+		speedDelta := ""
+		if prev, err := strconv.ParseFloat(strings.TrimSpace(prevSpeed), 64); err == nil {
+			speedDelta = fmt.Sprintf("%+.2f", res.downloadSpeed-prev)
+		}
+		cols = append(cols, prevSpeed, speedDelta)
+	}
+	coloChanged := ""
+	if prevColo != "" {
+		coloChanged = "否"
+		if prevColo != r.dataCenter {
+			coloChanged = "是"
+		}
+	}
+	return append(cols, prevColo, coloChanged)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDetectCSVColumns(t *testing.T) {
+	none := csvColumns{ip: -1, port: -1, latency: -1, speed: -1, colo: -1, domain: -1, node: -1}
+	with := func(set func(c *csvColumns)) csvColumns {
+		c := none
+		set(&c)
+		return c
+	}
+	tests := []struct {
+		name   string
+		header []string
+		want   csvColumns
+		ok     bool
+	}{
+		{
+			name:   "own output",
+			header: []string{"IP地址", "端口", "TLS", "数据中心", "地区", "国家代码", "国家", "城市", "网络延迟", "下载速度MB/s", "域名", "类型", "来源", "标签"},
+			want: with(func(c *csvColumns) {
+				c.ip, c.port, c.colo, c.latency, c.speed, c.domain, c.node = 0, 1, 3, 8, 9, 10, 13
+			}),
+			ok: true,
+		},
+		{
+			name:   "CloudflareST",
+			header: []string{"\uFEFFIP 地址", "已发送", "已接收", "丢包率", "平均延迟", "下载速度 (MB/s)"},
+			want:   with(func(c *csvColumns) { c.ip, c.latency, c.speed = 0, 4, 5 }),
+			ok:     true,
+		},
+		{
+			name:   "english with separators",
+			header: []string{"Port", "ip_address", "Avg-Latency", "Download Speed MB/s", "Colo", "Name"},
+			want:   with(func(c *csvColumns) { c.port, c.ip, c.latency, c.speed, c.colo, c.node = 0, 1, 2, 3, 4, 5 }),
+			ok:     true,
+		},
+		{
+			name:   "first matching column wins",
+			header: []string{"ip", "host", "port"},
+			want:   with(func(c *csvColumns) { c.ip, c.port = 0, 2 }),
+			ok:     true,
+		},
+		{
+			name:   "no ip column",
+			header: []string{"端口", "延迟"},
+			want:   with(func(c *csvColumns) { c.port, c.latency = 0, 1 }),
+			ok:     false,
+		},
+		{
+			name:   "data row",
+			header: []string{"1.1.1.1", "443"},
+			want:   none,
+			ok:     false,
+		},
+	}
+	for _, tt := range tests {
+		got, ok := detectCSVColumns(tt.header)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: detectCSVColumns() = %+v, %v, want %+v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCSVColumnsFor(t *testing.T) {
+	tests := []struct {
+		first     []string
+		hasHeader bool
+		ip, port  int
+	}{
+		{[]string{"IP", "Port"}, true, 0, 1},
+		{[]string{"1.1.1.1", "443"}, false, 0, 1},
+		{[]string{"[2606:4700::1]", "443"}, false, 0, 1},
+		{[]string{"服务器", "端口号"}, true, 0, 1},
+	}
+	for _, tt := range tests {
+		cols, hasHeader := csvColumnsFor(tt.first)
+		if hasHeader != tt.hasHeader || cols.ip != tt.ip || cols.port != tt.port {
+			t.Errorf("csvColumnsFor(%v) = %+v, %v", tt.first, cols, hasHeader)
+		}
+	}
+}
+
+func TestReadCSVTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "own output with BOM",
+			content: "\uFEFFIP地址,端口,TLS,数据中心,网络延迟,标签\n1.1.1.1,443,true,HKG,30 ms,a\n[2606:4700::1],2053,true,NRT,40 ms,b\n",
+			want:    []string{"1.1.1.1:443 a", "[2606:4700::1]:2053 b"},
+		},
+		{
+			name:    "CloudflareST without port column",
+			content: "IP 地址,已发送,已接收,丢包率,平均延迟,下载速度 (MB/s)\n104.16.1.2,4,4,0.00,150.00,10.00\n",
+			want:    []string{"104.16.1.2:443 "},
+		},
+		{
+			name:    "tab separated",
+			content: "ip\tport\tname\n1.1.1.1\t8443\tx y\n",
+			want:    []string{"1.1.1.1:8443 x y"},
+		},
+		{
+			name:    "no header",
+			content: "1.1.1.1,443\n1.1.1.2,2053\n",
+			want:    []string{"1.1.1.1:443 ", "1.1.1.2:2053 "},
+		},
+		{
+			name:    "bad rows are skipped",
+			content: "ip,port\n1.1.1.1,443\n1.1.1.2,\n1.1.1.3,\"44\"3\n1.1.1.4,70000\nnot a host!,443\n1.1.1.5,443,extra\n",
+			want:    []string{"1.1.1.1:443 ", "1.1.1.5:443 "},
+		},
+		{
+			name:    "empty",
+			content: "",
+		},
+	}
+	for _, tt := range tests {
+		var got []string
+		err := readCSVTargets(bufio.NewReader(strings.NewReader(tt.content)), func(target Target) {
+			got = append(got, target.String()+" "+target.Tag)
+		})
+		if err != nil {
+			t.Errorf("%s: readCSVTargets() error = %v", tt.name, err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: readCSVTargets() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// 压缩格式
+const (
+	compressGzip = "gzip"
+	compressXz   = "xz"
+	compressZstd = "zstd"
+	compressZip  = "zip"
+)
+
+// compressMagics 各压缩格式文件开头的魔数
+var compressMagics = []struct {
+	format string
+	magic  []byte
+}{
+	{compressGzip, []byte{0x1f, 0x8b}},
+	{compressXz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{compressZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{compressZip, []byte("PK\x03\x04")},
+}
+
+// compressExts 压缩文件的扩展名，识别内容格式时去掉
+var compressExts = []string{".gz", ".gzip", ".xz", ".zst", ".zstd"}
+
+// detectCompression 根据开头的魔数识别压缩格式，未压缩时返回空
+func detectCompression(head []byte) string {
+	for _, m := range compressMagics {
+		if bytes.HasPrefix(head, m.magic) {
+			return m.format
+		}
+	}
+	return ""
+}
+
+// sourceExt 返回来源的小写扩展名，压缩文件返回去掉压缩扩展名后的扩展名（ip.csv.gz → .csv）
+func sourceExt(filePath string) string {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	for _, c := range compressExts {
+		if ext == c {
+			return strings.ToLower(filepath.Ext(strings.TrimSuffix(filePath, filepath.Ext(filePath))))
+		}
+	}
+	return ext
+}
+
+// decompressReader 返回 gzip/xz/zstd 解压后的流
+func decompressReader(format string, r io.Reader) (io.ReadCloser, error) {
+	switch format {
+	case compressGzip:
+		return gzip.NewReader(r)
+	case compressXz:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xr), nil
+	case compressZstd:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderLowmem(true))
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("不支持的压缩格式: %s", format)
+}
+
+// readZipSource 逐个解析 zip 中的每个文件。r 是本地文件时直接随机读取，否则（如标准输入）先读入内存
+func readZipSource(filePath string, r io.Reader, emit func(Target)) (int, error) {
+	var ra io.ReaderAt
+	var size int64
+	if f, ok := r.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+			ra, size = f, info.Size()
+		}
+	}
+	if ra == nil {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return 0, err
+		}
+		ra, size = bytes.NewReader(data), int64(len(data))
+	}
+	archive, err := zip.NewReader(ra, size)
+	if err != nil {
+		return 0, fmt.Errorf("zip解析失败: %w", err)
+	}
+
+	total := 0
+	for _, member := range archive.File {
+		name := member.Name
+		base := filepath.Base(name)
+		if member.FileInfo().IsDir() || strings.HasSuffix(base, "~") || strings.HasPrefix(base, ".") {
+			continue
+		}
+		rc, err := member.Open()
+		if err != nil {
+			fmt.Printf("读取 %s 中的 %s 时出错: %v\n", filePath, name, err)
+			continue
+		}
+		memberPath := filePath + "!" + name
+		count, err := readIPsFromReader(memberPath, rc, emit)
+		rc.Close()
+		total += count
+		if err != nil {
+			fmt.Printf("读取 %s 时出错: %v\n", memberPath, err)
+			continue
+		}
+		fmt.Printf("正在读取压缩包成员: %s 解析到 %d 条\n", memberPath, count)
+	}
+	return total, nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// compressTestData 用指定格式压缩数据，gzip 可由多个成员拼接而成
+func compressTestData(t *testing.T, format string, parts ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, part := range parts {
+		var w io.WriteCloser
+		var err error
+		switch format {
+		case compressGzip:
+			w = gzip.NewWriter(&buf)
+		case compressXz:
+			w, err = xz.NewWriter(&buf)
+		case compressZstd:
+			w, err = zstd.NewWriter(&buf)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, part)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// zipTestData 按顺序写入 zip 成员，名称以 / 结尾的为目录
+func zipTestData(t *testing.T, members ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, m := range members {
+		f, err := w.Create(m[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(f, m[1])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readTestSource 读取数据并返回每个目标的 "键 来源"
+func readTestSource(t *testing.T, filePath string, r io.Reader) []string {
+	t.Helper()
+	var got []string
+	count, err := readIPsFromReader(filePath, r, func(target Target) {
+		got = append(got, target.Key()+" "+target.Source)
+	})
+	if err != nil || count != len(got) {
+		t.Errorf("readIPsFromReader(%s) = %d, %v, emitted %d", filePath, count, err, len(got))
+	}
+	return got
+}
+
+func TestDetectCompression(t *testing.T) {
+	tests := []struct {
+		head []byte
+		want string
+	}{
+		{[]byte{0x1f, 0x8b, 0x08}, compressGzip},
+		{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00}, compressXz},
+		{[]byte{0x28, 0xb5, 0x2f, 0xfd, 0x04}, compressZstd},
+		{[]byte("PK\x03\x04\x14\x00"), compressZip},
+		{[]byte("PK\x05\x06"), ""},
+		{[]byte{0x1f}, ""},
+		{[]byte("1.1.1.1 443\n"), ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := detectCompression(tt.head); got != tt.want {
+			t.Errorf("detectCompression(%x) = %q, want %q", tt.head, got, tt.want)
+		}
+	}
+}
+
+func TestSourceExt(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"ip.txt", ".txt"},
+		{"IP.CSV.GZ", ".csv"},
+		{"nodes.yaml.zst", ".yaml"},
+		{"dir/result.xml.xz", ".xml"},
+		{"ip.gz", ""},
+		{"a.zip!sub/b.json", ".json"},
+		{"https://example.com/ip.csv.gzip", ".csv"},
+	}
+	for _, tt := range tests {
+		if got := sourceExt(tt.path); got != tt.want {
+			t.Errorf("sourceExt(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestReadCompressed 按魔数识别压缩格式，与扩展名无关；压缩的 CSV 按去掉压缩扩展名后的格式解析
+func TestReadCompressed(t *testing.T) {
+	const text = "1.1.1.1 443\n1.0.0.1:2053\n"
+	for _, format := range []string{compressGzip, compressXz, compressZstd} {
+		for _, name := range []string{"ip.txt", "ip.bin", "ip." + format} {
+			got := readTestSource(t, name, bytes.NewReader(compressTestData(t, format, text)))
+			if want := []string{"1.1.1.1:443 " + name, "1.0.0.1:2053 " + name}; !slices.Equal(got, want) {
+				t.Errorf("%s as %s = %v, want %v", format, name, got, want)
+			}
+		}
+	}
+
+	// 多个成员拼接的 gzip 全部读出
+	got := readTestSource(t, "ip.gz", bytes.NewReader(compressTestData(t, compressGzip, "1.1.1.1 443\n", "1.0.0.1 443\n")))
+	if want := []string{"1.1.1.1:443 ip.gz", "1.0.0.1:443 ip.gz"}; !slices.Equal(got, want) {
+		t.Errorf("multi-member gzip = %v, want %v", got, want)
+	}
+
+	csv := "IP地址,端口,网络延迟\n104.16.1.2,2053,120 ms\n"
+	got = readTestSource(t, "result.csv.zst", bytes.NewReader(compressTestData(t, compressZstd, csv)))
+	if want := []string{"104.16.1.2:2053 result.csv.zst"}; !slices.Equal(got, want) {
+		t.Errorf("compressed csv = %v, want %v", got, want)
+	}
+
+	if _, err := readIPsFromReader("bad.gz", bytes.NewReader([]byte{0x1f, 0x8b, 0x00}), func(Target) {}); err == nil {
+		t.Error("truncated gzip accepted")
+	}
+}
+
+// TestReadZip 逐个解析 zip 成员，来源记为 a.zip!成员，嵌套的 zip 和压缩成员同样展开
+func TestReadZip(t *testing.T) {
+	inner := zipTestData(t, [2]string{"c.txt", "1.1.1.3 443\n"})
+	archive := zipTestData(t,
+		[2]string{"a.txt", "1.1.1.1 443\n"},
+		[2]string{"sub/", ""},
+		[2]string{"sub/b.csv", "IP地址,端口\n1.1.1.2,2053\n"},
+		[2]string{"inner.zip", string(inner)},
+		[2]string{"d.txt.xz", string(compressTestData(t, compressXz, "2606:4700::1 443\n"))},
+		[2]string{".hidden", "9.9.9.9 443\n"},
+		[2]string{"a.txt~", "9.9.9.9 443\n"},
+	)
+	want := func(name string) []string {
+		return []string{
+			"1.1.1.1:443 " + name + "!a.txt",
+			"1.1.1.2:2053 " + name + "!sub/b.csv",
+			"1.1.1.3:443 " + name + "!inner.zip!c.txt",
+			"[2606:4700::1]:443 " + name + "!d.txt.xz",
+		}
+	}
+
+	// 从内存（如标准输入）读取
+	if got := readTestSource(t, "a.zip", bytes.NewReader(archive)); !slices.Equal(got, want("a.zip")) {
+		t.Errorf("zip from a stream = %v, want %v", got, want("a.zip"))
+	}
+
+	// 从本地文件随机读取，扩展名不影响识别
+	path := filepath.Join(t.TempDir(), "nodes.dat")
+	if err := os.WriteFile(path, archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	count, err := readIPsFromFile(path, func(target Target) {
+		got = append(got, target.Key()+" "+target.Source)
+	})
+	if err != nil || count != 4 || !slices.Equal(got, want(path)) {
+		t.Errorf("zip file = %v, %d, %v, want %v", got, count, err, want(path))
+	}
+
+	if _, err := readIPsFromReader("broken.zip", bytes.NewReader([]byte("PK\x03\x04broken")), func(Target) {}); err == nil {
+		t.Error("broken zip accepted")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// bogonPrefixes 私有、回环、链路本地、文档、组播及其他保留地址，不可能是公网上的 Cloudflare 节点
+var bogonPrefixes = []string{
+	"0.0.0.0/8",       // 本网络
+	"10.0.0.0/8",      // 私有地址
+	"100.64.0.0/10",   // 运营商级 NAT
+	"127.0.0.0/8",     // 回环
+	"169.254.0.0/16",  // 链路本地
+	"172.16.0.0/12",   // 私有地址
+	"192.0.0.0/24",    // IETF 协议分配
+	"192.0.2.0/24",    // 文档 TEST-NET-1
+	"192.168.0.0/16",  // 私有地址
+	"198.18.0.0/15",   // 基准测试
+	"198.51.100.0/24", // 文档 TEST-NET-2
+	"203.0.113.0/24",  // 文档 TEST-NET-3
+	"224.0.0.0/4",     // 组播
+	"240.0.0.0/4",     // 保留及广播
+	"::/128",          // 未指定地址
+	"::1/128",         // 回环
+	"64:ff9b:1::/48",  // 本地 NAT64
+	"100::/64",        // 丢弃前缀
+	"2001:db8::/32",   // 文档
+	"fc00::/7",        // 唯一本地地址
+	"fe80::/10",       // 链路本地
+	"ff00::/8",        // 组播
+}
+
+// addrSet 由若干已排序且互不重叠的地址区间组成，用于快速判断地址是否属于某个列表
+type addrSet struct {
+	ranges []ipRange
+}
+
+// newAddrSet 合并区间后创建地址集合
+func newAddrSet(ranges []ipRange) *addrSet {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].start.Less(ranges[j].start)
+	})
+	var merged []ipRange
+	for _, r := range ranges {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if last.start.Is4() == r.start.Is4() && (!last.end.Less(r.start) || last.end.Next() == r.start) {
+				if last.end.Less(r.end) {
+					last.end = r.end
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return &addrSet{ranges: merged}
+}
+
+// contains 判断地址是否落在集合内
+func (s *addrSet) contains(addr netip.Addr) bool {
+	if s == nil {
+		return false
+	}
+	addr = addr.Unmap()
+	// 找到第一个起始地址大于 addr 的区间，前一个区间即可能包含 addr
+	i := sort.Search(len(s.ranges), func(i int) bool {
+		return addr.Less(s.ranges[i].start)
+	})
+	if i == 0 {
+		return false
+	}
+	r := s.ranges[i-1]
+	return r.start.Is4() == addr.Is4() && !r.end.Less(addr)
+}
+
+// bogonSet 返回内置的非公网地址集合
+func bogonSet() *addrSet {
+	var ranges []ipRange
+	for _, spec := range bogonPrefixes {
+		start, end, _ := parseIPRange(spec)
+		ranges = append(ranges, ipRange{start: start, end: end, text: spec})
+	}
+	return newAddrSet(ranges)
+}
+
+// readExcludeList 读取 -exclude 指定的排除列表（文件或 http/https 地址，逗号分隔），
+// 每行一个 IP、CIDR 或 IP 段，# 之后为注释
+func readExcludeList(spec string) (*addrSet, error) {
+	var ranges []ipRange
+	for _, source := range strings.Split(spec, ",") {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+		localPath := source
+		if isRemoteSource(source) {
+			var err error
+			if localPath, err = fetchRemoteSource(source); err != nil {
+				return nil, fmt.Errorf("下载排除列表 %s 失败: %w", source, err)
+			}
+		}
+		rs, invalid, err := readExcludeFile(localPath)
+		if err != nil {
+			return nil, fmt.Errorf("读取排除列表 %s 时出错: %w", source, err)
+		}
+		fmt.Printf("读取排除列表: %s 共 %d 条", source, len(rs))
+		if invalid > 0 {
+			fmt.Printf("，跳过无效行 %d 条", invalid)
+		}
+		fmt.Println()
+		ranges = append(ranges, rs...)
+	}
+	return newAddrSet(ranges), nil
+}
+
+// readExcludeFile 读取单个排除列表文件，返回解析出的区间和无效行数
+func readExcludeFile(path string) (ranges []ipRange, invalid int, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ','
+		})
+		if len(fields) == 0 {
+			continue
+		}
+		entry := strings.Trim(fields[0], "[]")
+		if start, end, ok := parseIPRange(entry); ok {
+			if start.BitLen() != end.BitLen() || end.Less(start) {
+				return nil, 0, fmt.Errorf("第 %d 行 IP段起止地址无效: %s", lineNo, entry)
+			}
+			ranges = append(ranges, ipRange{start: start, end: end, text: entry})
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			addr = addr.Unmap()
+			ranges = append(ranges, ipRange{start: addr, end: addr, text: entry})
+		} else {
+			invalid++
+		}
+	}
+	return ranges, invalid, scanner.Err()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadExcludeFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		contains []string
+		excludes []string
+		invalid  int
+		wantErr  string
+	}{
+		{
+			name: "mixed entries",
+			content: "# 排除列表\n" +
+				"1.1.1.0/24 # 注释\n" +
+				"104.16.0.1-104.16.0.3,443\n" +
+				"[2606:4700::1]\n" +
+				"8.8.8.8\tgoogle\n" +
+				"\n" +
+				"not-an-ip\n",
+			contains: []string{"1.1.1.0", "1.1.1.255", "104.16.0.2", "2606:4700::1", "8.8.8.8"},
+			excludes: []string{"1.1.2.0", "104.16.0.4", "2606:4700::2"},
+			invalid:  1,
+		},
+		{
+			name:    "reversed range",
+			content: "1.1.1.1\n\n1.1.1.9-1.1.1.1\n",
+			wantErr: "第 3 行 IP段起止地址无效: 1.1.1.9-1.1.1.1",
+		},
+		{
+			name:    "mixed families",
+			content: "1.1.1.1-2606:4700::1\n",
+			wantErr: "第 1 行",
+		},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "exclude.txt")
+		if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ranges, invalid, err := readExcludeFile(path)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: readExcludeFile() error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || invalid != tt.invalid {
+			t.Errorf("%s: readExcludeFile() invalid = %d, err = %v, want %d", tt.name, invalid, err, tt.invalid)
+		}
+		set := newAddrSet(ranges)
+		for _, s := range tt.contains {
+			if !set.contains(netip.MustParseAddr(s)) {
+				t.Errorf("%s: %s not excluded", tt.name, s)
+			}
+		}
+		for _, s := range tt.excludes {
+			if set.contains(netip.MustParseAddr(s)) {
+				t.Errorf("%s: %s excluded", tt.name, s)
+			}
+		}
+	}
+}
+
+func TestAddrSetContains(t *testing.T) {
+	set := bogonSet()
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"192.168.1.1", true},
+		{"::ffff:192.168.1.1", true},
+		{"fe80::1", true},
+		{"1.1.1.1", false},
+		{"104.16.0.1", false},
+		{"2606:4700::1", false},
+	}
+	for _, tt := range tests {
+		if got := set.contains(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("bogonSet().contains(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+	var nilSet *addrSet
+	if nilSet.contains(netip.MustParseAddr("10.0.0.1")) {
+		t.Error("nil addrSet contains an address")
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ipRange 表示一段连续的IP地址区间 [start, end]，以及该行指定的端口
+type ipRange struct {
+	start netip.Addr
+	end   netip.Addr
+	port  int
+	text  string // 原始写法，用于提示信息
+	tag   string // 行尾 #注释 中的标签
+}
+
+// target 由区间内的地址生成目标
+func (r ipRange) target(addr netip.Addr) Target {
+	t := addrTarget(addr, r.port)
+	t.Tag = r.tag
+	return t
+}
+
+// parseRangeLine 尝试将一行解析为 CIDR 或 IP 段（a.b.c.d-a.b.c.e），可选端口列表用空白或逗号分隔，
+// 端口列表中的每个端口各生成一个区间
+// ok 为 false 表示该行不是 CIDR/IP 段格式，应交给其他格式继续解析
+func parseRangeLine(line string) (rs []ipRange, ok bool, err error) {
+	if idx := strings.Index(line, "#"); idx != -1 {
+		line = line[:idx]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 1 {
+		fields = strings.SplitN(fields[0], ",", 2)
+	}
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, false, nil
+	}
+	spec := fields[0]
+	if !strings.Contains(spec, "/") && !strings.Contains(spec, "-") {
+		return nil, false, nil
+	}
+	start, end, isRange := parseIPRange(spec)
+	if !isRange {
+		return nil, false, nil
+	}
+	if start.BitLen() != end.BitLen() || end.Less(start) {
+		return nil, true, fmt.Errorf("IP段起止地址无效: %s", spec)
+	}
+	ports := []int{443}
+	if len(fields) == 2 {
+		if ports, err = parsePortSpec(fields[1]); err != nil {
+			return nil, true, err
+		}
+	}
+	for _, p := range ports {
+		rs = append(rs, ipRange{start: start, end: end, port: p, text: spec})
+	}
+	return rs, true, nil
+}
+
+// parseIPRange 解析 CIDR（104.16.0.0/20、2606:4700::/32）或 IP 段（1.1.1.1-1.1.1.9）
+func parseIPRange(spec string) (start, end netip.Addr, ok bool) {
+	if strings.Contains(spec, "/") {
+		prefix, err := netip.ParsePrefix(spec)
+		if err != nil {
+			return start, end, false
+		}
+		prefix = prefix.Masked()
+		start = prefix.Addr()
+		return start, lastAddr(prefix), true
+	}
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return start, end, false
+	}
+	var err error
+	if start, err = netip.ParseAddr(strings.Trim(parts[0], "[]")); err != nil {
+		return start, end, false
+	}
+	if end, err = netip.ParseAddr(strings.Trim(parts[1], "[]")); err != nil {
+		return start, end, false
+	}
+	return start.Unmap(), end.Unmap(), true
+}
+
+// lastAddr 返回前缀中的最后一个地址
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	a16 := prefix.Addr().As16()
+	hostBits := prefix.Addr().BitLen() - prefix.Bits()
+	for i := 15; i >= 0 && hostBits > 0; i-- {
+		n := hostBits
+		if n > 8 {
+			n = 8
+		}
+		a16[i] |= byte(1<<n - 1)
+		hostBits -= n
+	}
+	addr := netip.AddrFrom16(a16)
+	if prefix.Addr().Is4() {
+		return addr.Unmap()
+	}
+	return addr
+}
+
+// addrUint128 将地址转换为 128 位无符号整数（高 64 位、低 64 位）
+func addrUint128(a netip.Addr) (hi, lo uint64) {
+	b := a.As16()
+	for i := 0; i < 8; i++ {
+		hi = hi<<8 | uint64(b[i])
+		lo = lo<<8 | uint64(b[i+8])
+	}
+	return hi, lo
+}
+
+// rangeSize 返回区间内的地址数量，超出 uint64 时返回 math.MaxUint64
+func rangeSize(r ipRange) uint64 {
+	sh, sl := addrUint128(r.start)
+	eh, el := addrUint128(r.end)
+	lo, borrow := bits.Sub64(el, sl, 0)
+	hi, _ := bits.Sub64(eh, sh, borrow)
+	if hi != 0 || lo == math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return lo + 1
+}
+
+// mergeRanges 合并端口和标签相同且重叠或相邻的区间，避免重复展开
+func mergeRanges(ranges []ipRange) []ipRange {
+	if len(ranges) < 2 {
+		return ranges
+	}
+	sorted := make([]ipRange, len(ranges))
+	copy(sorted, ranges)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].port != sorted[j].port {
+			return sorted[i].port < sorted[j].port
+		}
+		if sorted[i].tag != sorted[j].tag {
+			return sorted[i].tag < sorted[j].tag
+		}
+		return sorted[i].start.Less(sorted[j].start)
+	})
+
+	merged := []ipRange{sorted[0]}
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		next := last.end.Next()
+		sameFamily := last.start.BitLen() == r.start.BitLen()
+		if sameFamily && r.port == last.port && r.tag == last.tag && (!next.IsValid() || !next.Less(r.start)) {
+			if last.end.Less(r.end) {
+				last.end = r.end
+			}
+			last.text = last.start.String() + "-" + last.end.String()
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// expandedAddrs 本次运行已展开或抽样的地址总数，-maxexpand 限制的是所有输入合计的数量
+var expandedAddrs uint64
+
+// expandRanges 合并并逐个展开所有区间为目标交给 emit，启用 -sample 时改为按子网抽样。
+// 展开后总数会超过 -maxexpand 的区间将被拒绝，避免大量较小的区间累计展开出过多目标
+func expandRanges(ranges []ipRange, emit func(Target)) {
+	for _, r := range mergeRanges(ranges) {
+		size := rangeSize(r)
+		if *sampleMode != "" {
+			size = sampleRangeCount(r)
+		}
+		if limit := uint64(*maxExpand); *maxExpand > 0 && (size > limit || expandedAddrs+size > limit) {
+			fmt.Printf("跳过IP段 %s 端口 %d: 共 %s 个地址，超过展开上限 %d 的剩余额度 %d (可通过 -maxexpand 调整)\n",
+				r.text, r.port, formatRangeSize(size), *maxExpand, limit-expandedAddrs)
+			continue
+		}
+		expandedAddrs += size
+		if *sampleMode != "" {
+			sampled := sampleRange(r, emit)
+			fmt.Printf("抽样IP段 %s 端口 %d: 抽取 %d 个地址\n", r.text, r.port, sampled)
+			continue
+		}
+		fmt.Printf("展开IP段 %s 端口 %d: 共 %d 个地址\n", r.text, r.port, size)
+		for addr := r.start; addr.IsValid(); addr = addr.Next() {
+			emit(r.target(addr))
+			if addr == r.end {
+				break
+			}
+		}
+	}
+}
+
+// formatRangeSize 格式化地址数量，超出 uint64 的区间显示为 ">1.8e19"
+func formatRangeSize(size uint64) string {
+	if size == math.MaxUint64 {
+		return ">1.8e19"
+	}
+	return strconv.FormatUint(size, 10)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"math"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestParseIPRange(t *testing.T) {
+	tests := []struct {
+		spec       string
+		start, end string
+		ok         bool
+	}{
+		{"104.16.0.0/20", "104.16.0.0", "104.16.15.255", true},
+		{"104.16.3.7/22", "104.16.0.0", "104.16.3.255", true},
+		{"1.1.1.1/32", "1.1.1.1", "1.1.1.1", true},
+		{"2606:4700::/32", "2606:4700::", "2606:4700:ffff:ffff:ffff:ffff:ffff:ffff", true},
+		{"1.1.1.1-1.1.1.9", "1.1.1.1", "1.1.1.9", true},
+		{"[2606:4700::1]-[2606:4700::9]", "2606:4700::1", "2606:4700::9", true},
+		{"::ffff:1.1.1.1-::ffff:1.1.1.2", "1.1.1.1", "1.1.1.2", true},
+		{"1.1.1.1/33", "", "", false},
+		{"1.1.1-1.1.1.9", "", "", false},
+		{"example.com", "", "", false},
+	}
+	for _, tt := range tests {
+		start, end, ok := parseIPRange(tt.spec)
+		if ok != tt.ok {
+			t.Errorf("parseIPRange(%q) ok = %v, want %v", tt.spec, ok, tt.ok)
+			continue
+		}
+		if ok && (start.String() != tt.start || end.String() != tt.end) {
+			t.Errorf("parseIPRange(%q) = %s-%s, want %s-%s", tt.spec, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestParseRangeLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		ports   []int
+		ok      bool
+		wantErr bool
+	}{
+		{"104.16.0.0/30", []int{443}, true, false},
+		{"104.16.0.0/30 2053", []int{2053}, true, false},
+		{"104.16.0.0/30,443,8443 # 标签", []int{443, 8443}, true, false},
+		{"1.1.1.1-1.1.1.4 80-82", []int{80, 81, 82}, true, false},
+		{"1.1.1.9-1.1.1.1", nil, true, true},
+		{"1.1.1.1-2606:4700::1", nil, true, true},
+		{"104.16.0.0/30 http", cfHTTPPorts, true, false},
+		{"104.16.0.0/30 80-x", nil, true, true},
+		{"1.1.1.1 443", nil, false, false},
+		{"example.com:443", nil, false, false},
+		{"a b c", nil, false, false},
+	}
+	for _, tt := range tests {
+		rs, ok, err := parseRangeLine(tt.line)
+		if ok != tt.ok || (err != nil) != tt.wantErr {
+			t.Errorf("parseRangeLine(%q) ok = %v, err = %v", tt.line, ok, err)
+			continue
+		}
+		var ports []int
+		for _, r := range rs {
+			ports = append(ports, r.port)
+		}
+		if !slices.Equal(ports, tt.ports) {
+			t.Errorf("parseRangeLine(%q) ports = %v, want %v", tt.line, ports, tt.ports)
+		}
+	}
+}
+
+// testRange 由 "起始-结束" 构造区间
+func testRange(t *testing.T, spec string, port int) ipRange {
+	t.Helper()
+	start, end, ok := parseIPRange(spec)
+	if !ok {
+		t.Fatalf("invalid range %q", spec)
+	}
+	return ipRange{start: start, end: end, port: port, text: spec}
+}
+
+func TestMergeRanges(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []string
+		port []int
+		want []string
+	}{
+		{"overlapping", []string{"1.1.1.1-1.1.1.9", "1.1.1.5-1.1.1.20"}, []int{443, 443}, []string{"1.1.1.1-1.1.1.20"}},
+		{"adjacent", []string{"1.1.1.0/25", "1.1.1.128/25"}, []int{443, 443}, []string{"1.1.1.0-1.1.1.255"}},
+		{"contained", []string{"1.1.0.0/16", "1.1.1.0/24"}, []int{443, 443}, []string{"1.1.0.0-1.1.255.255"}},
+		{"gap", []string{"1.1.1.1-1.1.1.2", "1.1.1.4-1.1.1.5"}, []int{443, 443}, []string{"1.1.1.1-1.1.1.2", "1.1.1.4-1.1.1.5"}},
+		{"different ports", []string{"1.1.1.1-1.1.1.2", "1.1.1.1-1.1.1.2"}, []int{443, 80}, []string{"1.1.1.1-1.1.1.2", "1.1.1.1-1.1.1.2"}},
+		{"address families", []string{"255.255.255.254/31", "::/127"}, []int{443, 443}, []string{"255.255.255.254-255.255.255.255", "::-::1"}},
+		{"ipv6 end of space", []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fff0/124", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe/127"}, []int{443, 443},
+			[]string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fff0-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"}},
+	}
+	for _, tt := range tests {
+		var in []ipRange
+		for i, spec := range tt.in {
+			in = append(in, testRange(t, spec, tt.port[i]))
+		}
+		var got []string
+		for _, r := range mergeRanges(in) {
+			got = append(got, r.start.String()+"-"+r.end.String())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: mergeRanges() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRangeSize(t *testing.T) {
+	tests := []struct {
+		spec string
+		want uint64
+	}{
+		{"1.1.1.1/32", 1},
+		{"104.16.0.0/20", 4096},
+		{"0.0.0.0/0", 1 << 32},
+		{"2606:4700::/64", math.MaxUint64},
+		{"2606:4700::/65", 1 << 63},
+		{"2606:4700::/32", math.MaxUint64},
+	}
+	for _, tt := range tests {
+		if got := rangeSize(testRange(t, tt.spec, 443)); got != tt.want {
+			t.Errorf("rangeSize(%s) = %d, want %d", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestExpandRangesCumulativeLimit(t *testing.T) {
+	oldMax, oldSample, oldExpanded := *maxExpand, *sampleMode, expandedAddrs
+	defer func() { *maxExpand, *sampleMode, expandedAddrs = oldMax, oldSample, oldExpanded }()
+	*maxExpand, *sampleMode, expandedAddrs = 300, "", 0
+
+	var got []netip.AddrPort
+	emit := func(target Target) { got = append(got, target.AddrPort) }
+	// 每个 /24 都不超过上限，但合计超过：第二个 /24 放不下被跳过，较小的 /30 仍可展开
+	expandRanges([]ipRange{
+		testRange(t, "10.0.0.0/24", 443),
+		testRange(t, "10.0.2.0/24", 443),
+		testRange(t, "10.0.4.0/30", 443),
+	}, emit)
+	if len(got) != 260 || expandedAddrs != 260 {
+		t.Fatalf("expanded %d targets (counter %d), want 260", len(got), expandedAddrs)
+	}
+	if got[0].String() != "10.0.0.0:443" || got[259].String() != "10.0.4.3:443" {
+		t.Errorf("expanded %s .. %s", got[0], got[259])
+	}
+
+	// 上限按整个运行累计，后续输入只能使用剩余额度
+	got = nil
+	expandRanges([]ipRange{testRange(t, "10.1.0.0/26", 443)}, emit)
+	expandRanges([]ipRange{testRange(t, "10.1.1.0/29", 443)}, emit)
+	if len(got) != 8 || expandedAddrs != 268 {
+		t.Errorf("later input expanded %d targets (counter %d), want 8", len(got), expandedAddrs)
+	}
+}
@@ -1,5 +1,10 @@
 module github.com/Vivo-Max/immortalwrt-iptest/iptest
 
-go 1.22
+go 1.24.0
 
-require golang.org/x/net v0.48.0
+require (
+	github.com/klauspost/compress v1.17.11
+	github.com/ulikunitz/xz v0.5.17
+	golang.org/x/net v0.48.0
+	gopkg.in/yaml.v3 v3.0.1
+)
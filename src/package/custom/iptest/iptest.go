@@ -3,8 +3,10 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto/tls"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -12,6 +14,7 @@ import (
 	"mime/multipart"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"os"
 	"os/exec"
@@ -22,6 +25,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"golang.org/x/net/proxy"
 )
@@ -32,7 +36,7 @@ const (
 )
 
 var (
-	Path         = flag.String("path", "ip.txt", "指定包含IP地址的文件或目录")          // IP地址文件或目录
+	Path         = flag.String("path", "ip.txt", "指定包含IP地址的文件、目录、命名管道或http/https地址，多个用逗号分隔，-表示标准输入")          // IP地址文件或目录
 	outFile      = flag.String("outfile", "ip.csv", "输出文件名称")                              // 输出文件名称
 	maxThreads   = flag.Int("max", 100, "并发请求最大协程数")                                       // 最大协程数
 	speedTest    = flag.Int("speedtest", 5, "下载测速协程数量,设为0禁用测速")                            // 下载测速协程数量
@@ -40,7 +44,52 @@ var (
     speedTestURL = flag.String("url", "speed.cloudflare.com/__down?bytes=500000000", "测速文件地址") // 测速文件地址
 	enableTLS    = flag.Bool("tls", true, "是否启用TLS")                                       // TLS是否启用
 	TCPurl       = flag.String("tcpurl", "www.speedtest.net", "TCP请求地址")                   // TCP请求地址
-	ports = flag.String("ports", "", "指定仅输出这些端口的结果，用逗号分隔，空表示不过滤")
+	ports = flag.String("ports", "", "指定仅测试这些端口，用逗号分隔，支持范围(2052-2096)及http/https，空表示不过滤")
+	testPorts    = flag.String("testports", "", "将每个主机与这些端口逐一组合后测试(替换原端口)，格式同 -ports，如 https 表示Cloudflare全部HTTPS端口")
+	maxExpand    = flag.Int("maxexpand", 65536, "所有CIDR/IP段合计最多展开的地址数，会超出上限的IP段将被跳过，0表示不限制")
+	sampleMode    = flag.String("sample", "", "CIDR/IP段抽样模式: random(随机)、first(前K个)、last(后K个)、stride(等间隔)，空表示全部展开")
+	sampleK       = flag.Int("samplek", 1, "抽样时每个子网抽取的地址数")
+	samplePrefix4 = flag.Int("sample4", 24, "IPv4抽样子网前缀长度")
+	samplePrefix6 = flag.Int("sample6", 48, "IPv6抽样子网前缀长度(常用48或64)")
+	sampleSeed    = flag.Int64("seed", 0, "随机抽样种子，0表示使用当前时间，相同种子和输入可复现抽样结果")
+	cacheDir      = flag.String("cachedir", "/tmp/iptest/cache", "远程源缓存目录，下载失败时使用上次缓存")
+	fetchTimeout  = flag.Duration("fetchtimeout", 30*time.Second, "远程源下载超时时间")
+	fetchMaxMB    = flag.Int64("fetchmax", 32, "远程源最大下载大小(MB)")
+	templateLinks = flag.String("template", "", "模板分享链接(或包含链接的文件)，用排名靠前的IP替换服务器地址和端口生成新节点")
+	nodeCount     = flag.Int("nodes", 10, "生成新节点时使用的结果数量")
+	nodeOut       = flag.String("nodeout", "nodes", "新节点输出文件前缀，生成 .txt、_base64.txt、_clash.yaml、_singbox.json")
+	resolverSpec  = flag.String("resolver", "system", "域名解析器，逗号分隔多个可对比结果: system、DNS服务器(223.5.5.5、tcp://8.8.8.8:53)、DoH地址(https://1.1.1.1/dns-query)，none表示不解析")
+	dedupMem      = flag.Int("dedupmem", 16, "去重使用的内存上限(MB)，目标过多时改用布隆过滤器以限制内存，可能极少量误判")
+	exclude       = flag.String("exclude", "", "排除列表文件或http/https地址，每行一个IP、CIDR或IP段，多个用逗号分隔")
+	filterBogon   = flag.Bool("bogon", true, "过滤私有、回环、组播等非公网地址，设为false禁用")
+	parseJSON     = flag.Bool("json", false, "parse 子命令以JSON Lines格式输出诊断结果")
+	retestFile    = flag.String("retest", "", "重测模式：重新测试上次结果CSV中的IP(替代 -path)，追加上次延迟/速度、变化量及数据中心是否变化")
+	sourceMax     = flag.Int("sourcemax", 0, "每个来源(文件或地址)最多测试的目标数(去重后)，0表示不限制")
+	genFamilies   = flag.String("gen", "", "从Cloudflare IP段生成候选目标: 4、6或4,6，未指定 -path 且 ip.txt 不存在时自动使用4,6")
+	genPorts      = flag.String("genports", "443", "生成目标使用的端口，格式同 -ports")
+	gen6Count     = flag.Int("gen6", 1000, "生成IPv6目标时随机抽取的 /48 数量，每个 /48 随机取 -samplek 个地址")
+	uciImport     = flag.Bool("uci", false, "导入 -ucidir 下 passwall、passwall2、shadowsocksr、homeproxy 配置中的节点进行测试")
+	uciDir        = flag.String("ucidir", "/etc/config", "UCI配置目录")
+	searchSpec    = flag.String("search", "", "网络空间搜索引擎查询，格式 引擎:查询语句，引擎可选 fofa、hunter、quake、zoomeye、shodan；密钥由环境变量 FOFA_KEY 等提供，FOFA_API 等可替换API地址")
+	searchMax     = flag.Int("searchmax", 1000, "每条搜索最多获取的结果数，用于控制额度消耗")
+	searchDelay   = flag.Duration("searchdelay", time.Second, "搜索翻页请求的间隔")
+	searchCols    = flag.String("searchcols", "", "输出搜索结果中的字段: all 或逗号分隔的 asn、org、country")
+	shardFlag     = flag.String("shard", "", "只测试去重后目标的一个分片，格式 i/n 表示共n片中的第i片；auto/n 为轮换模式，每次运行测试下一片并合并到滚动结果文件，n次运行覆盖全部目标")
+	shardState    = flag.String("shardstate", "", "轮换分片的游标文件，默认为 -outfile 加 .shard 后缀")
+	rollFile      = flag.String("rollfile", "", "轮换分片的滚动结果文件，默认为 -outfile 加 _rolling 后缀")
+	traceFields   = flag.String("trace", "", "输出 /cdn-cgi/trace 中的字段: all 或逗号分隔的 ip、loc、tls、http、sni、warp、visit_scheme、fl、ray(CF-RAY中的数据中心)")
+	kindFilter    = flag.String("kind", "", "只保留这些类型的结果，逗号分隔: official(官方节点)、proxy(反代)、unknown(未知)，空表示不过滤")
+	probeCount    = flag.Int("count", 1, "每个目标探测的次数，大于1时统计最低/平均/中位数延迟、抖动、丢包率和数据中心是否稳定，以中位数作为延迟")
+	probeGap      = flag.Duration("gap", 200*time.Millisecond, "多次探测之间的间隔")
+	maxLoss       = flag.Float64("maxloss", 100, "多次探测时允许的最大丢包率(%)，超过的目标视为无效")
+	maxJitter     = flag.Duration("maxjitter", 0, "多次探测时允许的最大抖动，如 20ms，0表示不限制")
+	rankBy        = flag.String("rankby", "connect", "作为延迟用于排序和过滤的阶段: connect(TCP连接)、tls(TLS握手)、ttfb(首字节)、total(总耗时)")
+	showPhases    = flag.Bool("phases", false, "输出TCP连接、TLS握手、首字节和总耗时各阶段的耗时列")
+	hostHeader    = flag.String("host", "", "探测请求的Host，默认使用分享链接中的host/SNI或 -tcpurl")
+	sniFlag       = flag.String("sni", "", "探测时TLS握手使用的SNI，默认使用分享链接中的SNI或Host")
+	insecureTLS   = flag.Bool("insecure", false, "探测时不校验TLS证书")
+	certPinSpec   = flag.String("pin", "", "只接受这些SHA-256指纹(十六进制或base64，逗号分隔)的证书，指定后不再校验证书链和域名")
+	cfURL         = flag.String("cfurl", "", "刷新Cloudflare IP段的地址或文件，多个用逗号分隔，如 https://www.cloudflare.com/ips-v4,https://www.cloudflare.com/ips-v6，失败时使用内置列表")
 
 	telegramToken   = flag.String("telegram_token", "", "Telegram Bot TOKEN")
 	telegramChatID  = flag.String("telegram_chat_id", "", "Telegram Chat ID")
@@ -51,15 +100,18 @@ var (
 )
 
 type result struct {
-	ip          string        // IP地址
-	port        int           // 端口
+	target      Target        // 测试目标
 	dataCenter  string        // 数据中心
 	region      string        // 地区
 	cca1        string         // 国家代码	
 	cca2        string         // 国家
 	city        string        // 城市
 	latency     string        // 延迟
-	tcpDuration time.Duration // TCP请求延迟
+	tcpDuration time.Duration // 延迟：-rankby 选择的阶段耗时，多次探测时为中位数
+	trace       traceInfo     // /cdn-cgi/trace 返回的字段
+	kind        string        // 类型: official、proxy、unknown
+	stats       latencyStats  // 多次探测的延迟统计
+	phases      phaseTimings  // 各阶段耗时，多次探测时为中位数
 }
 
 type speedtestresult struct {
@@ -426,7 +478,23 @@ func gracefulExit(msg string, code int) {
 	os.Exit(code)
 }
 
+// flagSet 判断命令行中是否显式指定了某个参数
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
 func main() {
+	// iptest parse [参数]：只解析来源并输出逐行诊断，不进行探测
+	if len(os.Args) > 1 && os.Args[1] == "parse" {
+		runParse(os.Args[2:])
+		return
+	}
 	flag.Parse()
 
 	defer func() {
@@ -441,6 +509,61 @@ func main() {
 		sendTelegramMessage("*🚀 开始延迟/速度测试*") // 推送开始测试的消息
 	}
 
+	if !validSampleMode(*sampleMode) {
+		gracefulExit(fmt.Sprintf("*⚠️ 错误*\n不支持的抽样模式: %s", *sampleMode), 1)
+	}
+	if *probeCount < 1 {
+		gracefulExit("*⚠️ 错误*\n-count 须大于0", 1)
+	}
+	if pins, err := parseCertPins(*certPinSpec); err != nil {
+		gracefulExit(fmt.Sprintf("*⚠️ 错误*\n%v", err), 1)
+	} else {
+		certPins = pins
+	}
+	if err := validPhase(*rankBy); err != nil {
+		gracefulExit(fmt.Sprintf("*⚠️ 错误*\n%v", err), 1)
+	}
+	if *sampleK < 1 || *samplePrefix4 < 0 || *samplePrefix4 > 32 || *samplePrefix6 < 0 || *samplePrefix6 > 128 {
+		gracefulExit("*⚠️ 错误*\n抽样参数无效: -samplek 须大于0，-sample4 须在0-32之间，-sample6 须在0-128之间", 1)
+	}
+
+	if info, err := parseShard(*shardFlag); err != nil {
+		gracefulExit(fmt.Sprintf("*⚠️ 错误*\n%v", err), 1)
+	} else {
+		shard = info
+	}
+	if shard.rotating {
+		fmt.Printf("轮换分片模式: 本次测试分片 %s\n", shard)
+	}
+	traceCols, colsErr := selectedTraceColumns(*traceFields)
+	if colsErr != nil {
+		gracefulExit(fmt.Sprintf("*⚠️ 错误*\n%v", colsErr), 1)
+	}
+	searchColList, colsErr := selectedSearchColumns(*searchCols)
+	if colsErr != nil {
+		gracefulExit(fmt.Sprintf("*⚠️ 错误*\n%v", colsErr), 1)
+	}
+	kinds, kindErr := parseKinds(*kindFilter)
+	if kindErr != nil {
+		gracefulExit(fmt.Sprintf("*⚠️ 错误*\n%v", kindErr), 1)
+	}
+	if _, _, err := parseGenFamilies(*genFamilies); err != nil {
+		gracefulExit(fmt.Sprintf("*⚠️ 错误*\n%v", err), 1)
+	}
+	if err := applyUCISources(); err != nil {
+		gracefulExit(fmt.Sprintf("*⚠️ 错误*\n%v", err), 1)
+	}
+	// 未指定 -path 且默认的 ip.txt 不存在时不再读取它；没有其他输入时改为从内置 Cloudflare IP 段生成候选目标
+	if *retestFile == "" && !*uciImport && !flagSet("path") {
+		if _, err := os.Stat(*Path); os.IsNotExist(err) {
+			if *genFamilies == "" && *searchSpec == "" {
+				fmt.Printf("未找到 %s，改为从内置Cloudflare IP段生成候选目标 (-gen 4,6)\n", *Path)
+				*genFamilies = "4,6"
+			}
+			*Path = ""
+		}
+	}
+
 	startTime := time.Now()
 	osType := runtime.GOOS
 	// 如果是linux系统,尝试提升文件描述符的上限
@@ -466,141 +589,64 @@ func main() {
 		locationMap[loc.Iata] = loc
 	}
 
-	ips, err := readIPs(*Path)
-	if err != nil {
-		gracefulExit(fmt.Sprintf("*⚠️ 错误*\n无法从文件中读取 IP: %v", err), 1)
+	// 重测模式下读取上次的结果文件
+	if *retestFile != "" {
+		*Path = *retestFile
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(len(ips))
-
-	resultChan := make(chan result, len(ips))
-
-	thread := make(chan struct{}, *maxThreads)
-
-	var count int
-	total := len(ips)
-
-	for _, ip := range ips {
-		thread <- struct{}{}
-		go func(ip string) {
-			defer func() {
-				<-thread
-				wg.Done()
-				count++
-				percentage := float64(count) / float64(total) * 100
-				fmt.Printf("已完成: %d 总数: %d 已完成: %.2f%%\r", count, total, percentage)
-				if count == total {
-					fmt.Printf("已完成: %d 总数: %d 已完成: %.2f%%\n", count, total, percentage)
-				}
-			}()
-
-			parts := strings.Fields(ip)
-			if len(parts) != 2 {
-				fmt.Printf("IP地址格式错误: %s\n", ip)
-				return
-			}
-			ipAddr := parts[0]
-			portStr := parts[1]
-
-			port, err := strconv.Atoi(portStr)
-			if err != nil {
-				fmt.Printf("端口格式错误: %s\n", portStr)
-				return
-			}
-
-			dialer := &net.Dialer{
-				Timeout:   timeout,
-				KeepAlive: 0,
-			}
-			start := time.Now()
-			conn, err := dialer.Dial("tcp", net.JoinHostPort(ipAddr, strconv.Itoa(port)))
-			if err != nil {
-				return
-			}
-			defer conn.Close()
-
-			tcpDuration := time.Since(start)
-			start = time.Now()
-
-			client := http.Client{
-				Transport: &http.Transport{
-					Dial: func(network, addr string) (net.Conn, error) {
-						return conn, nil
-					},
-				},
-				Timeout: timeout,
-			}
-
-			var protocol string
-			if *enableTLS {
-				protocol = "https://"
-			} else {
-				protocol = "http://"
-			}
-			requestURL := protocol + *TCPurl + "/cdn-cgi/trace"
-
-			req, _ := http.NewRequest("GET", requestURL, nil)
-
-			// 添加用户代理
-			req.Header.Set("User-Agent", "Mozilla/5.0")
-			req.Close = true
-			resp, err := client.Do(req)
-			if err != nil {
-				return
-			}
-
-			duration := time.Since(start)
-			if duration > maxDuration {
-				return
-			}
-
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return
-			}
+	// 读取与探测同时进行：读取协程流式产出目标，固定数量的探测协程从通道中取出并测试
+	targets := make(chan Target, *maxThreads)
+	var total int
+	var readErr error
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		total, readErr = readIPs(*Path, targets)
+	}()
 
-			if strings.Contains(string(body), "uag=Mozilla/5.0") {
-				if matches := regexp.MustCompile(`colo=([A-Z]+)`).FindStringSubmatch(string(body)); len(matches) > 1 {
-					dataCenter := matches[1]
-					loc, ok := locationMap[dataCenter]
-					if ok {
-						fmt.Printf("发现有效IP %s 端口 %d 位置信息 %s 延迟 %d 毫秒\n", ipAddr, port, loc.City, tcpDuration.Milliseconds())
-						resultChan <- result{
-							ip:          ipAddr,
-							port:        port,
-							dataCenter:  dataCenter,
-							region:      loc.Region,
-							cca1:        loc.Cca1,
-							cca2:        loc.Cca2,
-							city:        loc.City,
-							latency:     fmt.Sprintf("%d ms", tcpDuration.Milliseconds()),
-							tcpDuration: tcpDuration,
-						}
-					} else {
-						fmt.Printf("发现有效IP %s 端口 %d 位置信息未知 延迟 %d 毫秒\n", ipAddr, port, tcpDuration.Milliseconds())
-						resultChan <- result{
-							ip:          ipAddr,
-							port:        port,
-							dataCenter:  dataCenter,
-							region:      "",
-							cca1:        "",
-							cca2:        "",
-							city:        "",
-							latency:     fmt.Sprintf("%d ms", tcpDuration.Milliseconds()),
-							tcpDuration: tcpDuration,
-						}
-					}
+	var valid []result
+	var validMutex sync.Mutex
+	var count atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < *maxThreads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range targets {
+				res, ok := probeTarget(ip, locationMap)
+				if ok {
+					validMutex.Lock()
+					valid = append(valid, res)
+					validMutex.Unlock()
 				}
+				done := count.Add(1)
+				// 目标总数在读取结束前未知，显示已完成数和排队中的数量
+				fmt.Printf("已完成: %d 排队: %d\r", done, len(targets))
 			}
-		}(ip)
+		}()
 	}
-
 	wg.Wait()
-	close(resultChan)
+	<-readDone
+	if readErr != nil {
+		gracefulExit(fmt.Sprintf("*⚠️ 错误*\n无法从文件中读取 IP: %v", readErr), 1)
+	}
+	fmt.Printf("已完成: %d 总数: %d 已完成: 100.00%%\n", count.Load(), total)
+
+	// 区分官方节点与反代，按 -kind 过滤后再测速
+	kindCounts := make(map[string]int)
+	if len(valid) > 0 {
+		kindCounts = classifyResults(valid)
+		if kinds != nil {
+			valid = filterKinds(valid, kinds)
+			fmt.Printf("按 -kind %s 过滤后保留 %d 个有效IP\n", *kindFilter, len(valid))
+		}
+	}
 
-	if len(resultChan) == 0 {
+	if len(valid) == 0 {
 		fmt.Println("没有发现有效的IP")
+		if shard.rotating {
+			finishRotatingShard(nil, nil)
+		}
 		if *telegramToken != "" && len(chatIDs) > 0 {
 			sendTelegramMessage("*⚠️ 无检测结果*")
 		}
@@ -609,48 +655,46 @@ func main() {
 	var results []speedtestresult
 	if *speedTest > 0 {
 		fmt.Printf("开始测速\n")
+		resultChan := make(chan result)
+		go func() {
+			defer close(resultChan)
+			for _, res := range valid {
+				resultChan <- res
+			}
+		}()
 		var wg2 sync.WaitGroup
-		wg2.Add(*speedTest)
-		count = 0
-		total := len(resultChan)
+		var resultsMutex sync.Mutex
+		var tested int
+		speedTotal := len(valid)
 		results = []speedtestresult{}
 		for i := 0; i < *speedTest; i++ {
-			thread <- struct{}{}
+			wg2.Add(1)
 			go func() {
-				defer func() {
-					<-thread
-					wg2.Done()
-				}()
+				defer wg2.Done()
 				for res := range resultChan {
 
-					downloadSpeed := getDownloadSpeed(res.ip, res.port)
-					results = append(results, speedtestresult{result: res, downloadSpeed: downloadSpeed})
+					downloadSpeed := getDownloadSpeed(res.target.Host(), res.target.Port())
 
-					count++
-					percentage := float64(count) / float64(total) * 100
+					resultsMutex.Lock()
+					results = append(results, speedtestresult{result: res, downloadSpeed: downloadSpeed})
+					tested++
+					percentage := float64(tested) / float64(speedTotal) * 100
 					fmt.Printf("已完成: %.2f%%\r", percentage)
-					if count == total {
+					if tested == speedTotal {
 						fmt.Printf("已完成: %.2f%%\033[0\n", percentage)
 					}
+					resultsMutex.Unlock()
 				}
 			}()
 		}
 		wg2.Wait()
 	} else {
-		for res := range resultChan {
+		for _, res := range valid {
 			results = append(results, speedtestresult{result: res})
 		}
 	}
 
-	if *speedTest > 0 {
-		sort.Slice(results, func(i, j int) bool {
-			return results[i].downloadSpeed > results[j].downloadSpeed
-		})
-	} else {
-		sort.Slice(results, func(i, j int) bool {
-			return results[i].result.tcpDuration < results[j].result.tcpDuration
-		})
-	}
+	sortResults(results)
 
 	file, err := os.Create(*outFile)
 	if err != nil {
@@ -659,46 +703,35 @@ func main() {
 	defer file.Close()
 	writer := csv.NewWriter(file)
 	// 写入头部
-    if *speedTest > 0 {
-        writer.Write([]string{
-            "IP地址", "端口", "TLS", "数据中心", "地区", "国家代码", "国家", "城市", "网络延迟", "下载速度MB/s",
-        })
-    } else {
-        writer.Write([]string{
-            "IP地址", "端口", "TLS", "数据中心", "地区", "国家代码", "国家", "城市", "网络延迟",
-        })
-    }
-	allowedPorts := make(map[int]bool)
-	if *ports != "" {
-		portStrs := strings.Split(*ports, ",")
-		for _, pStr := range portStrs {
-			p, err := strconv.Atoi(strings.TrimSpace(pStr))
-			if err == nil && p > 0 && p < 65536 {
-				allowedPorts[p] = true
-			}
-		}
-	}
+	layout := newResultLayout(results, traceCols, searchColList)
+	header := layout.header()
+	writer.Write(header)
 	// 写入数据
-    for _, res := range results {
-		if len(allowedPorts) > 0 && !allowedPorts[res.result.port] {
+	var records [][]string
+	for _, res := range results {
+		if *speedTest > 0 && res.downloadSpeed < float64(*speedLimit) {
 			continue
 		}
-        if *speedTest > 0 && res.downloadSpeed >= float64(*speedLimit) {
-            writer.Write([]string{
-                res.result.ip, strconv.Itoa(res.result.port), strconv.FormatBool(*enableTLS), res.result.dataCenter,
-                res.result.region, res.result.cca1, res.result.cca2, res.result.city, res.result.latency,
-                fmt.Sprintf("%.2f", res.downloadSpeed),
-            })
-        } else if *speedTest == 0 {
-            writer.Write([]string{
-                res.result.ip, strconv.Itoa(res.result.port), strconv.FormatBool(*enableTLS), res.result.dataCenter,
-                res.result.region, res.result.cca1, res.result.cca2, res.result.city, res.result.latency,
-            })
-        }
-    }
+		record := layout.record(res)
+		writer.Write(record)
+		records = append(records, record)
+	}
 	writer.Flush()
 	fmt.Printf("成功将结果写入文件 %s，耗时 %d秒\n", *outFile, time.Since(startTime)/time.Second)
 
+	// 轮换分片：合并到滚动结果文件并移动游标
+	rollingCount := 0
+	if shard.rotating {
+		rollingCount = finishRotatingShard(header, records)
+	}
+
+	// 根据模板链接生成新节点
+	if *templateLinks != "" {
+		if err := writeRewrittenNodes(results); err != nil {
+			fmt.Printf("生成节点失败: %v\n", err)
+		}
+	}
+
 	// 生成检测报告
 	var report strings.Builder
 	duration := time.Since(startTime)
@@ -769,7 +802,56 @@ func main() {
 		fmt.Fprintf(&report, "⏰ 开始时间: %s\n", startTimeLocal.Format("2006/01/02 15:04:05"))
 		fmt.Fprintf(&report, "⏰ 运行耗时: %02d时 %02d分 %02d秒\n", hours, minutes, seconds)
 		fmt.Fprintf(&report, "  - 总计测试IP: %d\n", total)
+		if *sampleMode != "" {
+			fmt.Fprintf(&report, "  - 抽样: 从 %d 个子网抽取 %d 个地址 (种子 %d)\n", sampledSubnets, sampledAddrs, sampleSeedUsed)
+		}
 		fmt.Fprintf(&report, "  - 有效IP: %d\n", len(results))
+		coloMismatch := 0
+		for _, res := range results {
+			if res.result.trace.coloMismatch() {
+				coloMismatch++
+			}
+		}
+		if coloMismatch > 0 {
+			fmt.Fprintf(&report, "  - CF-RAY与trace数据中心不一致: %d 个\n", coloMismatch)
+		}
+		if shard.count > 1 {
+			fmt.Fprintf(&report, "  - 分片: %s", shard)
+			if shard.rotating {
+				fmt.Fprintf(&report, "，滚动结果共 %d 个", rollingCount)
+			}
+			fmt.Fprintf(&report, "\n")
+		}
+		if *retestFile != "" {
+			coloChanged := 0
+			for _, res := range results {
+				if prevColo := res.result.target.meta("prev_colo"); prevColo != "" && prevColo != res.result.dataCenter {
+					coloChanged++
+				}
+			}
+			fmt.Fprintf(&report, "  - 重测: 本次失效 %d 个，数据中心变化 %d 个\n", total-len(results), coloChanged)
+		}
+		if len(dnsMismatchDomains) > 0 {
+			fmt.Fprintf(&report, "  - DNS结果不一致: %s\n", strings.Join(dnsMismatchDomains, ", "))
+		}
+		if len(sourceTargetCounts) > 1 {
+			fmt.Fprintf(&report, "*📂 来源统计*\n")
+			for _, stat := range sourceStats(results) {
+				fmt.Fprintf(&report, "- %s: 目标 %d，有效 %d", stat.source, stat.targets, stat.valid)
+				if stat.valid > 0 {
+					fmt.Fprintf(&report, "，最低延迟 %dms", stat.bestLatency.Milliseconds())
+				}
+				fmt.Fprintf(&report, "\n")
+			}
+		}
+		fmt.Fprintf(&report, "*🏷️ 类型统计*\n")
+		for _, kind := range kindOrder {
+			fmt.Fprintf(&report, "- %s: %d 个", kindNames[kind], kindCounts[kind])
+			if kinds != nil && !kinds[kind] {
+				fmt.Fprintf(&report, " (已按 -kind 过滤)")
+			}
+			fmt.Fprintf(&report, "\n")
+		}
 		fmt.Fprintf(&report, "*🌍 国家分布*\n")
 		for _, cca1 := range countries {
 			name := countryNameMap[cca1]
@@ -779,9 +861,26 @@ func main() {
 			fmt.Fprintf(&report, "- %s %s (%d个)\n", getCountryFlag(cca1), name, countryCount[cca1])
 		}
 		fmt.Fprintf(&report, "*📈 延迟统计*\n")
+		if *rankBy != phaseConnect {
+			fmt.Fprintf(&report, "  - 延迟指标: %s\n", phaseName(*rankBy))
+		}
 		fmt.Fprintf(&report, "  - 均值: %.2fms\n", avgLatency)
 		fmt.Fprintf(&report, "  - 最低: %.2fms\n", minLatency)
 		fmt.Fprintf(&report, "  - 最高: %.2fms\n", maxLatency)
+		if *probeCount > 1 && len(results) > 0 {
+			var jitter, loss float64
+			unstable := 0
+			for _, res := range results {
+				jitter += float64(res.result.stats.jitter) / float64(time.Millisecond)
+				loss += res.result.stats.loss
+				if !res.result.stats.coloStable {
+					unstable++
+				}
+			}
+			n := float64(len(results))
+			fmt.Fprintf(&report, "  - 每个目标探测 %d 次(延迟取中位数)，平均抖动 %.2fms，平均丢包率 %.1f%%，数据中心不稳定 %d 个\n",
+				*probeCount, jitter/n, loss/n*100, unstable)
+		}
 		fmt.Fprintf(&report, "*⚡️ 速度统计*\n")
 		if *speedTest > 0 {
 			fmt.Fprintf(&report, "  - 均值: %.2f MB/s\n", avgSpeed)
@@ -814,14 +913,222 @@ func main() {
     }
 }
 
-// readIPs 函数根据提供的路径（文件或目录）读取IP地址
-func readIPs(path string) ([]string, error) {
-	var ips []string
+// readIPs 函数根据提供的路径（文件、目录、命名管道、http/https 地址或 - 表示标准输入，多个用逗号分隔）
+// 流式读取IP地址，经端口处理、域名解析和去重后逐个发送到 out，读取结束时关闭 out 并返回去重后的数量
+func readIPs(path string, out chan<- Target) (int, error) {
+	defer close(out)
+
+	stage, err := newTargetStage()
+	if err != nil {
+		return 0, err
+	}
+
+	// 读取 → 端口处理/域名解析 → 去重，各阶段通过有界通道衔接，内存占用与输入规模无关。
+	// 域名解析较慢，启用解析器时由多个协程并发处理
+	raw := make(chan Target, 1024)
+	processed := make(chan Target, 1024)
+	var readErr error
+	go func() {
+		defer close(raw)
+		_, readErr = readSources(path, func(target Target) {
+			raw <- target
+		})
+	}()
+
+	workers := 1
+	if stage.resolvers != nil {
+		workers = dnsConcurrency
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range raw {
+				stage.process(target, func(target Target) {
+					processed <- target
+				})
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(processed)
+	}()
+
+	// 对IP端口对进行去重，并按 -sourcemax 限制每个来源的目标数，分片时只保留属于当前分片的目标
+	dedup := newDedupFilter(*dedupMem)
+	totalCount, uniqueCount, cappedCount, shardSkipped := 0, 0, 0, 0
+	for target := range processed {
+		totalCount++
+		if *sourceMax > 0 && sourceTargetCounts[target.Source] >= *sourceMax {
+			cappedCount++
+			continue
+		}
+		if dedup.add(target.Key()) {
+			if !shard.contains(target) {
+				shardSkipped++
+				continue
+			}
+			sourceTargetCounts[target.Source]++
+			uniqueCount++
+			out <- target
+		}
+	}
+	if uniqueCount == 0 && readErr != nil {
+		return 0, readErr
+	}
+
+	if stage.testPorts != nil {
+		fmt.Printf("按 -testports 将每个主机与端口 %s 组合\n", formatPorts(stage.testPorts))
+	}
+	if stage.allowed != nil {
+		fmt.Printf("仅测试端口 %s: 保留 %d 条，过滤 %d 条\n", formatPorts(stage.portList), totalCount, stage.filtered.Load())
+	}
+	if stage.resolvers != nil {
+		if domains, addrs := stage.resolveStats(); domains > 0 {
+			fmt.Printf("域名解析完成: %d 个域名共解析出 %d 个地址\n", domains, addrs)
+		}
+		sort.Strings(dnsMismatchDomains)
+	}
+
+	// 计算并打印去重结果【使用粗实线边框】
+	duplicateCount := totalCount - uniqueCount - cappedCount - shardSkipped
+
+	// 定义框的宽度和内容
+	boxWidth := 50
+
+	// 格式化输出字符串
+	contents := []string{fmt.Sprintf("总计 %d 条，最终 %d 条，去重 %d 条。", totalCount, uniqueCount, duplicateCount)}
+	excluded, bogon := stage.excluded.Load(), stage.bogon.Load()
+	if excluded+bogon > 0 {
+		contents = append(contents, fmt.Sprintf("排除 %d 条：排除列表 %d 条，非公网地址 %d 条。", excluded+bogon, excluded, bogon))
+	}
+	if cappedCount > 0 {
+		contents = append(contents, fmt.Sprintf("超出来源上限 %d 条 (每个来源最多 %d 条)。", cappedCount, *sourceMax))
+	}
+	if shard.count > 1 {
+		contents = append(contents, fmt.Sprintf("分片 %s: 本次测试 %d 条，其他分片 %d 条。", shard, uniqueCount, shardSkipped))
+	}
+
+	// 定义新的粗实线字符
+	const (
+		cornerTopLeft     = "┏"
+		cornerTopRight    = "┓"
+		cornerBottomLeft  = "┗"
+		cornerBottomRight = "┛"
+		lineHorizontal    = "━" // 粗横线
+		lineVertical      = "┃" // 粗竖线
+	)
+	
+	// 创建分隔线
+	line := strings.Repeat(lineHorizontal, boxWidth)
+
+	// 打印信息框
+	fmt.Printf("\n%s%s%s\n", cornerTopLeft, line, cornerTopRight)
+	for _, content := range contents {
+		// 计算终端显示宽度 (假设中文字符占 2 栏)
+		contentDisplayWidth := 0
+		for _, r := range content {
+			if r <= 127 {
+				contentDisplayWidth += 1
+			} else {
+				contentDisplayWidth += 2
+			}
+		}
+
+		// 居中对齐内容
+		if contentDisplayWidth > boxWidth {
+			contentDisplayWidth = boxWidth
+		}
+
+		totalPadding := boxWidth - contentDisplayWidth
+		leftPaddingLength := totalPadding / 2
+		rightPaddingLength := totalPadding - leftPaddingLength 
+
+		leftPadding := strings.Repeat(" ", leftPaddingLength)
+		rightPadding := strings.Repeat(" ", rightPaddingLength)
+
+		fmt.Printf("%s%s%s%s%s\n", lineVertical, leftPadding, content, rightPadding, lineVertical)
+	}
+	fmt.Printf("%s%s%s\n\n", cornerBottomLeft, line, cornerBottomRight)
+	if readErr != nil {
+		fmt.Printf("⚠️ 读取来源时出错，已读取的 %d 条照常测试，结果可能不完整: %v\n", totalCount, readErr)
+	}
+	if rate := dedup.falsePositiveRate(); rate > 0 {
+		fmt.Printf("⚠️ 已使用布隆过滤器去重，估计误判率 %.2g%%，可通过 -dedupmem 调大内存上限\n", rate*100)
+	}
+
+	return uniqueCount, nil
+}
+
+// readSources 依次读取逗号分隔的多个来源，单个来源时出错直接返回，多个来源时跳过出错的来源
+func readSources(path string, emit func(Target)) (int, error) {
+	total := 0
+	var lastErr error
+	if *genFamilies != "" {
+		count, err := generateTargets(emit)
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	if *searchSpec != "" {
+		count, err := readSearch(*searchSpec, emit)
+		if err != nil {
+			fmt.Println(err)
+		}
+		total += count
+	}
+	sources := strings.Split(path, ",")
+	for _, source := range sources {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+		count, err := readSource(source, emit)
+		total += count
+		if err != nil {
+			if len(sources) == 1 {
+				return total, err
+			}
+			fmt.Printf("读取 %s 时出错: %v\n", source, err)
+			lastErr = err
+		}
+	}
+	if total == 0 && lastErr != nil {
+		return 0, lastErr
+	}
+	return total, nil
+}
+
+// readSource 读取单个来源：文件、目录（遍历其中所有文件）、http/https 地址、.url 远程源列表、.search 搜索列表或标准输入（-），
+// 每解析出一个目标调用一次 emit，返回解析出的目标数量
+func readSource(path string, emit func(Target)) (int, error) {
+	if isRemoteSource(path) {
+		return readRemoteSource(path, emit)
+	}
+	if strings.HasSuffix(path, ".url") {
+		return readURLList(path, emit)
+	}
+	if strings.HasSuffix(path, ".search") {
+		return readSearchList(path, emit)
+	}
+	if path == "-" {
+		count, err := readIPsFromFile(path, emit)
+		if err != nil {
+			return count, fmt.Errorf("读取标准输入时出错: %w", err)
+		}
+		fmt.Printf("正在读取标准输入: 解析到 %d 条\n", count)
+		return count, nil
+	}
+
 	fileInfo, err := os.Stat(path)
 	if err != nil {
-		return nil, fmt.Errorf("无法获取文件/目录信息: %w", err)
+		return 0, fmt.Errorf("无法获取文件/目录信息: %w", err)
 	}
 
+	total := 0
 	if fileInfo.IsDir() {
 		// 如果是目录，遍历所有文件
 		err := filepath.WalkDir(path, func(filePath string, d os.DirEntry, err error) error {
@@ -834,168 +1141,263 @@ func readIPs(path string) ([]string, error) {
 					return nil
 				}
 
-				newIps, err := readIPsFromFile(filePath)
+				// .url 文件中列出的是远程源地址
+				if strings.HasSuffix(d.Name(), ".url") {
+					count, err := readURLList(filePath, emit)
+					if err != nil {
+						fmt.Printf("读取文件 %s 时出错: %v\n", filePath, err)
+					}
+					total += count
+					return nil
+				}
+
+				// .search 文件中列出的是搜索引擎查询
+				if strings.HasSuffix(d.Name(), ".search") {
+					count, err := readSearchList(filePath, emit)
+					if err != nil {
+						fmt.Printf("读取文件 %s 时出错: %v\n", filePath, err)
+					}
+					total += count
+					return nil
+				}
+
+				count, err := readIPsFromFile(filePath, emit)
+				total += count
 				if err != nil {
 					fmt.Printf("读取文件 %s 时出错: %v\n", filePath, err)
 					return nil // 继续处理下一个文件
 				}
 
 				// 目录遍历模式下：添加/修改输出
-				fmt.Printf("正在读取文件: %s 解析到 %d 条\n", filePath, len(newIps))
-
-				ips = append(ips, newIps...)
+				fmt.Printf("正在读取文件: %s 解析到 %d 条\n", filePath, count)
 			}
 			return nil
 		})
 		if err != nil {
-			return nil, err
+			return total, err
 		}
 	} else {
-		// 如果是文件，直接读取
-		newIps, err := readIPsFromFile(path)
+		// 如果是文件（或命名管道），直接读取
+		count, err := readIPsFromFile(path, emit)
 		if err != nil {
-			return nil, fmt.Errorf("读取文件 %s 时出错: %w", path, err)
+			return count, fmt.Errorf("读取文件 %s 时出错: %w", path, err)
 		}
 
 		// 单文件模式下：添加/修改输出
-		fmt.Printf("正在读取文件: %s 解析到 %d 条\n", path, len(newIps))
+		fmt.Printf("正在读取文件: %s 解析到 %d 条\n", path, count)
 
-		ips = newIps
+		total = count
 	}
+	return total, nil
+}
 
-	// 记录去重前的总数
-	totalCount := len(ips)
+// portListPatterns 匹配 "主机 端口列表" 或 "主机:端口列表"，端口列表至少包含一个逗号或连字符
+var portListPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^(\[[0-9a-fA-F:.]+]|[0-9a-fA-F:.]+|[a-zA-Z0-9.-]+)\s+(\d{1,5}(?:\s*[,-]\s*\d{1,5})+)$`),
+	regexp.MustCompile(`^(\[[0-9a-fA-F:.]+]|[a-zA-Z0-9.-]+):(\d{1,5}(?:[,-]\d{1,5})+)$`),
+}
 
-	// 对IP端口对进行去重
-	uniqueIPs := make(map[string]bool)
-	var resultIPs []string
-	for _, ip := range ips {
-		if _, ok := uniqueIPs[ip]; !ok {
-			uniqueIPs[ip] = true
-			resultIPs = append(resultIPs, ip)
-		}
+// parsePortListLine 解析带端口列表的行，ok 为 true 且 ports 为 nil 表示端口列表无效
+func parsePortListLine(line string) (host string, ports []int, ok bool) {
+	if idx := strings.Index(line, "#"); idx != -1 {
+		line = strings.TrimSpace(line[:idx])
 	}
-
-	// 计算并打印去重结果【使用粗实线边框】
-	uniqueCount := len(resultIPs)
-	duplicateCount := totalCount - uniqueCount
-
-	// 定义框的宽度和内容
-	boxWidth := 50
-
-	// 格式化输出字符串
-	content := fmt.Sprintf("总计 %d 条，最终 %d 条，去重 %d 条。", totalCount, uniqueCount, duplicateCount)
-
-	// 计算终端显示宽度 (假设中文字符占 2 栏)
-	contentDisplayWidth := 0
-	for _, r := range content {
-		if r <= 127 {
-			contentDisplayWidth += 1
-		} else {
-			contentDisplayWidth += 2
+	for _, pattern := range portListPatterns {
+		if matches := pattern.FindStringSubmatch(line); len(matches) == 3 {
+			ports, _ = parsePortSpec(matches[2])
+			return strings.Trim(matches[1], "[]"), ports, true
 		}
 	}
-
-	// 定义新的粗实线字符
-	const (
-		cornerTopLeft     = "┏"
-		cornerTopRight    = "┓"
-		cornerBottomLeft  = "┗"
-		cornerBottomRight = "┛"
-		lineHorizontal    = "━" // 粗横线
-		lineVertical      = "┃" // 粗竖线
-	)
-	
-	// 创建分隔线
-	line := strings.Repeat(lineHorizontal, boxWidth)
-
-	// 辅助函数：居中对齐内容
-	if contentDisplayWidth > boxWidth {
-		contentDisplayWidth = boxWidth
-	}
-
-	totalPadding := boxWidth - contentDisplayWidth
-	leftPaddingLength := totalPadding / 2
-	rightPaddingLength := totalPadding - leftPaddingLength 
-
-	leftPadding := strings.Repeat(" ", leftPaddingLength)
-	rightPadding := strings.Repeat(" ", rightPaddingLength)
-
-	// 打印信息框
-	fmt.Printf("\n%s%s%s\n", cornerTopLeft, line, cornerTopRight)
-	fmt.Printf("%s%s%s%s%s\n", lineVertical, leftPadding, content, rightPadding, lineVertical)
-	fmt.Printf("%s%s%s\n\n", cornerBottomLeft, line, cornerBottomRight)
-
-	return resultIPs, nil
+	return "", nil, false
 }
 
-// readIPsFromFile 从单个文件中逐行读取IP地址和端口，支持多种格式
-func readIPsFromFile(filePath string) ([]string, error) {
+// readIPsFromFile 从单个文件中逐行读取IP地址和端口，支持多种格式，每解析出一个目标调用一次 emit，
+// 返回解析出的目标数量
+func readIPsFromFile(filePath string, emit func(Target)) (int, error) {
+    if filePath == "-" {
+        return readIPsFromReader(filePath, os.Stdin, emit)
+    }
     file, err := os.Open(filePath)
     if err != nil {
-        return nil, err
+        return 0, err
     }
     defer file.Close()
+    return readIPsFromReader(filePath, file, emit)
+}
 
-    ips := make([]string, 0)
-
-    // 如果是CSV文件，单独解析
-    if strings.ToLower(filepath.Ext(filePath)) == ".csv" {
-        reader := csv.NewReader(file)
-        reader.TrimLeadingSpace = true
-
-        // 自动判断分隔符（先试逗号，失败再试制表符）
-        records, err := reader.ReadAll()
-        if err != nil {
-            file.Seek(0, 0)
-            reader = csv.NewReader(file)
-            reader.Comma = '\t'
-            records, err = reader.ReadAll()
-            if err != nil {
-                return nil, err
+// readIPsFromReader 从流中读取IP地址和端口，gzip/xz/zstd 压缩的内容边读边解压，zip 压缩包逐个解析其中的文件，
+// filePath 用于提示信息和按扩展名识别格式
+func readIPsFromReader(filePath string, r io.Reader, emit func(Target)) (int, error) {
+    input := bufio.NewReaderSize(r, 64*1024)
+    magic, _ := input.Peek(8)
+    switch format := detectCompression(magic); format {
+    case "":
+    case compressZip:
+        fmt.Printf("检测到zip压缩包: %s\n", filePath)
+        if r, ok := r.(*os.File); ok {
+            if _, err := r.Seek(0, io.SeekStart); err == nil {
+                return readZipSource(filePath, r, emit)
             }
         }
+        return readZipSource(filePath, input, emit)
+    default:
+        decompressed, err := decompressReader(format, input)
+        if err != nil {
+            return 0, fmt.Errorf("%s解压失败: %w", format, err)
+        }
+        defer decompressed.Close()
+        fmt.Printf("检测到%s压缩: %s\n", format, filePath)
+        return readIPsFromReader(filePath, decompressed, emit)
+    }
 
-        // 去掉UTF-8 BOM
-        if len(records) > 0 && len(records[0]) > 0 && strings.HasPrefix(records[0][0], "\ufeff") {
-            records[0][0] = strings.TrimPrefix(records[0][0], "\ufeff")
+    count := 0
+    var lineTag string // 当前行的 #注释 标签
+    add := func(target Target) {
+        count++
+        if target.Source == "" {
+            target.Source = filePath
+        }
+        if target.Tag == "" {
+            target.Tag = lineTag
+        }
+        parseDiag.target(target)
+        emit(target)
+    }
+    // addHost 由主机和端口生成目标，主机或端口无效时跳过该行
+    addHost := func(host string, port int, line string) {
+        target, err := newTarget(host, port)
+        if err != nil {
+            skipLine(err.Error(), line)
+            return
         }
+        add(target)
+    }
+    parseDiag.startFile(filePath)
 
-        for i, record := range records {
-            if i == 0 {
-                continue // 跳过标题行
-            }
-            if len(record) < 3 {
-                continue
-            }
-            ipAddr := strings.TrimSpace(record[0]) // 第1列 ip
-            portStr := strings.TrimSpace(record[1]) // 第2列 port
-            if ipAddr == "" || portStr == "" {
-                continue
-            }
-            port, err := strconv.Atoi(portStr)
-            if err == nil && port > 0 && port < 65536 {
-                ip := fmt.Sprintf("%s %d", ipAddr, port)
-                ips = append(ips, ip)
+    // CSV 文件逐行按列解析
+    if sourceExt(filePath) == ".csv" {
+        return count, readCSVTargets(input, add)
+    }
+
+    // nmap/masscan 扫描结果逐行或逐条流式解析
+    head, _ := input.Peek(4096)
+    if scanFormat := detectScanFormat(filePath, head); scanFormat != "" {
+        parseDiag.begin(0, "")
+        parseDiag.match(scanFormat)
+        ports, err := readScanOutput(scanFormat, input, add)
+        parseDiag.end()
+        fmt.Printf("检测到%s输出: %s 开放端口 %d 个\n", scanFormat, filePath, ports)
+        return count, err
+    }
+
+    // Clash/Mihomo、sing-box、Xray 配置和 base64 编码的订阅需要整体读取，其余格式逐行解析。
+    // -uci 导入的插件配置不看开头内容，直接按 UCI 解析
+    isUCI := uciSources[filePath]
+    if isUCI || looksLikeBase64(head) || looksLikeConfig(filePath, head) {
+        content, err := io.ReadAll(input)
+        if err != nil {
+            return count, err
+        }
+        parseConfig := parseProxyConfig
+        if isUCI {
+            parseConfig = parseUCIConfig
+        }
+        if targets, format, ok := parseConfig(filePath, content); ok {
+            fmt.Printf("检测到%s配置: %s 解析到 %d 个节点\n", format, filePath, len(targets))
+            parseDiag.begin(0, "")
+            parseDiag.match(format + "配置")
+            for _, target := range targets {
+                add(target)
             }
+            parseDiag.end()
+            return count, nil
         }
-        return ips, nil
+        if isUCI {
+            fmt.Printf("UCI配置 %s 中没有节点\n", filePath)
+            return count, nil
+        }
+        if decoded, ok := decodeSubscription(content); ok {
+            fmt.Printf("检测到base64订阅: %s\n", filePath)
+            content = decoded
+        }
+        input = bufio.NewReader(bytes.NewReader(content))
     }
-
-    scanner := bufio.NewScanner(file)
+    scanner := bufio.NewScanner(input)
 
     type jsonIP struct {
         IP   string `json:"ip"`
         Port string `json:"port"`
     }
 
+    // CIDR 与 IP 段先收集，读完整个文件后合并再展开
+    var ranges []ipRange
+
+    lineNo := 0
     for scanner.Scan() {
+        lineNo++
         line := strings.TrimSpace(scanner.Text())
         if line == "" || strings.HasPrefix(line, "#") {
             continue // 跳过空行和注释
         }
+        parseDiag.begin(lineNo, line)
+
+        // 行尾的 #注释 作为标签（分享链接中的 # 后为节点名称，由链接解析处理）
+        lineTag = ""
+        if !strings.Contains(line, "://") {
+            if idx := strings.Index(line, "#"); idx > 0 {
+                lineTag = strings.TrimSpace(line[idx+1:])
+                line = strings.TrimSpace(line[:idx])
+            }
+        }
+
+        // 支持 CIDR（104.16.0.0/20 443）和 IP 段（1.1.1.1-1.1.1.9 443），无端口默认443
+        if rs, ok, err := parseRangeLine(line); ok {
+            parseDiag.match(formatRange)
+            if err != nil {
+                skipLine(err.Error(), line)
+            } else {
+                for i := range rs {
+                    rs[i].tag = lineTag
+                }
+                ranges = append(ranges, rs...)
+                parseDiag.note("读取结束后合并展开")
+            }
+            continue
+        }
 
-        // 支持解析代理链接 (如 vless://..., vmess://..., trojan://..., ss://...)
+        // 支持端口列表和端口范围（1.2.3.4 443,2053,8443 / 1.2.3.4 2052-2096 / [IPv6]:443,8443）
+        if host, portList, ok := parsePortListLine(line); ok {
+            parseDiag.match(formatPortList)
+            if portList == nil {
+                skipLine("端口列表无效", line)
+                continue
+            }
+            for _, p := range portList {
+                addHost(host, p, line)
+            }
+            continue
+        }
+
+        // 解析分享链接 (vmess/vless/trojan/ss/hysteria2 等)，保留原始链接和 SNI/Host/路径等参数
+        if strings.Contains(line, "://") {
+            node, err := parseShareLink(line)
+            if err == nil {
+                parseDiag.match("分享链接(" + node.scheme + ")")
+                if target, err := node.target(); err != nil {
+                    skipLine(err.Error(), line)
+                } else {
+                    add(target)
+                }
+                continue
+            }
+            if !errors.Is(err, errUnsupportedScheme) {
+                parseDiag.match("分享链接")
+                skipLine(err.Error(), line)
+                continue
+            }
+        }
+
+        // 其他协议的代理链接按 @host:port 提取
         // 支持 IPv4、[IPv6]:port、IPv6 port、域名、域名:port、无端口默认443
         proxyPattern := regexp.MustCompile(`@(\[[0-9a-fA-F:]+\]|[0-9]{1,3}(?:\.[0-9]{1,3}){3}|[a-zA-Z0-9.-]+)(?::(\d{1,5}))?`)
         if matches := proxyPattern.FindStringSubmatch(line); len(matches) >= 2 {
@@ -1005,7 +1407,8 @@ func readIPsFromFile(filePath string) ([]string, error) {
                 port = matches[2]
             }
             if p, err := strconv.Atoi(port); err == nil && p > 0 && p < 65536 {
-                ips = append(ips, fmt.Sprintf("%s %d", host, p))
+                parseDiag.match(formatProxyAt)
+                addHost(host, p, line)
                 continue
             }
         }
@@ -1019,18 +1422,20 @@ func readIPsFromFile(filePath string) ([]string, error) {
                 port = matches[2]
             }
             if p, err := strconv.Atoi(port); err == nil && p > 0 && p < 65536 {
-                ips = append(ips, fmt.Sprintf("%s %d", host, p))
+                parseDiag.match(formatHostColon)
+                addHost(host, p, line)
                 continue
             }
         }
 
         // 兼容 IPv6 port 或 域名 port 格式（空格分隔）
-        hostSpacePattern := regexp.MustCompile(`^([0-9a-fA-F:]+|[a-zA-Z0-9.-]+)\s+(\d{1,5})$`)
+        hostSpacePattern := regexp.MustCompile(`^([0-9a-fA-F:.]+|[a-zA-Z0-9.-]+)\s+(\d{1,5})$`)
         if matches := hostSpacePattern.FindStringSubmatch(line); len(matches) == 3 {
             host := matches[1]
             port := matches[2]
             if p, err := strconv.Atoi(port); err == nil && p > 0 && p < 65536 {
-                ips = append(ips, fmt.Sprintf("%s %d", host, p))
+                parseDiag.match(formatHostSpace)
+                addHost(host, p, line)
                 continue
             }
         }
@@ -1040,7 +1445,8 @@ func readIPsFromFile(filePath string) ([]string, error) {
         if matches := hostOnlyPattern.FindStringSubmatch(line); len(matches) == 2 {
             host := strings.Trim(matches[1], "[]")
             port := 443
-            ips = append(ips, fmt.Sprintf("%s %d", host, port))
+            parseDiag.match(formatHostOnly)
+            addHost(host, port, line)
             continue
         }
 
@@ -1050,7 +1456,8 @@ func readIPsFromFile(filePath string) ([]string, error) {
 			portStr := matches[1]
 			host := strings.Trim(matches[2], "[]")
 			if p, err := strconv.Atoi(portStr); err == nil && p > 0 && p < 65536 {
-				ips = append(ips, fmt.Sprintf("%s %d", host, p))
+				parseDiag.match(formatOpenTCP)
+				addHost(host, p, line)
 				continue
 			}
 		}
@@ -1061,22 +1468,26 @@ func readIPsFromFile(filePath string) ([]string, error) {
             host := strings.Trim(matches[1], "[]")
             port := matches[2]
             if p, err := strconv.Atoi(port); err == nil && p > 0 && p < 65536 {
-                ips = append(ips, fmt.Sprintf("%s %d", host, p))
+                parseDiag.match(formatIPPipe)
+                addHost(host, p, line)
                 continue
             }
         }
 
         var ipAddr string
         var portStr string
+        var sepFormat string
 
         // 先尝试解析为JSON
         var jip jsonIP
         if err := json.Unmarshal([]byte(line), &jip); err == nil && jip.IP != "" && jip.Port != "" {
             ipAddr = jip.IP
             portStr = jip.Port
+            sepFormat = formatJSONLine
         } else {
             // 尝试解析各种格式
             if strings.Contains(line, ":") {
+                sepFormat = formatColonSep
                 lastColon := strings.LastIndex(line, ":")
                 if lastColon != -1 {
                     ipAddr = line[:lastColon]
@@ -1089,6 +1500,7 @@ func readIPsFromFile(filePath string) ([]string, error) {
                     }
                 }
             } else if strings.Contains(line, "：") {
+                sepFormat = formatFullColon
                 lastColon := strings.LastIndex(line, "：")
                 if lastColon != -1 {
                     ipAddr = line[:lastColon]
@@ -1101,12 +1513,14 @@ func readIPsFromFile(filePath string) ([]string, error) {
                     }
                 }
             } else if strings.Contains(line, ",") {
+                sepFormat = formatCommaSep
                 parts := strings.Split(line, ",")
                 if len(parts) >= 2 {
                     ipAddr = parts[0]
                     portStr = parts[1]
                 }
             } else {
+                sepFormat = formatSpaceSep
                 lineWithSpace := strings.ReplaceAll(line, "：", " ")
                 parts := strings.Fields(lineWithSpace)
                 if len(parts) >= 2 {
@@ -1117,23 +1531,171 @@ func readIPsFromFile(filePath string) ([]string, error) {
         }
 
         if ipAddr != "" && portStr != "" {
+            parseDiag.match(sepFormat)
             ipAddr = strings.Trim(strings.Trim(ipAddr, "[]"), " \t")
             portStr = strings.TrimSpace(portStr)
             port, err := strconv.Atoi(portStr)
             if err == nil && port > 0 && port < 65536 {
-                ip := fmt.Sprintf("%s %d", ipAddr, port)
-                ips = append(ips, ip)
+                addHost(ipAddr, port, line)
             } else {
-                fmt.Printf("跳过无效行(格式错误): %s\n", line)
+                skipLine("端口无效", line)
             }
         } else {
-            fmt.Printf("跳过无效行(无法解析): %s\n", line)
+            skipLine("无法解析", line)
         }
     }
-    return ips, scanner.Err()
+    parseDiag.end()
+    lineTag = ""
+    expandRanges(ranges, add)
+    return count, scanner.Err()
 }
 
 
+// probeTarget 探测单个目标 -count 次（间隔 -gap），通过 /cdn-cgi/trace 获取数据中心信息并统计延迟，
+// ok 为 false 表示目标无效。每次都会完成全部探测，丢包率按失败次数占总次数计算；
+// 全部失败或未达到 -maxloss/-maxjitter 要求的目标判为无效，trace 取自首次成功的探测
+func probeTarget(target Target, locationMap map[string]location) (res result, ok bool) {
+	ipAddr, port := target.IP(), target.Port()
+
+	var trace traceInfo
+	var durations []time.Duration
+	var samples []phaseTimings
+	var colos []string
+	for i := 0; i < *probeCount; i++ {
+		if i > 0 {
+			time.Sleep(*probeGap)
+		}
+		t, phases, ok := probeOnce(target)
+		if !ok {
+			continue
+		}
+		if len(samples) == 0 {
+			trace = t
+		}
+		durations = append(durations, phases.get(*rankBy))
+		samples = append(samples, phases)
+		colos = append(colos, t.get("colo"))
+	}
+	if len(samples) == 0 {
+		return result{}, false
+	}
+
+	stats := newLatencyStats(durations, colos, *probeCount)
+	if ok, reason := stats.acceptable(); !ok {
+		fmt.Printf("跳过IP %s 端口 %d: %s\n", ipAddr, port, reason)
+		return result{}, false
+	}
+	// 多次探测时以中位数作为延迟，排序、过滤和输出均使用该值
+	tcpDuration := stats.median
+	dataCenter := trace.get("colo")
+	res = result{
+		target:      target,
+		dataCenter:  dataCenter,
+		latency:     fmt.Sprintf("%d ms", tcpDuration.Milliseconds()),
+		tcpDuration: tcpDuration,
+		trace:       trace,
+		stats:       stats,
+		phases:      medianPhases(samples),
+	}
+	if loc, ok := locationMap[dataCenter]; ok {
+		fmt.Printf("发现有效IP %s 端口 %d 位置信息 %s 延迟 %d 毫秒\n", ipAddr, port, loc.City, tcpDuration.Milliseconds())
+		res.region = loc.Region
+		res.cca1 = loc.Cca1
+		res.cca2 = loc.Cca2
+		res.city = loc.City
+	} else {
+		fmt.Printf("发现有效IP %s 端口 %d 位置信息未知 延迟 %d 毫秒\n", ipAddr, port, tcpDuration.Milliseconds())
+	}
+	return res, true
+}
+
+// probeOnce 对目标进行一次探测：建立TCP连接并请求 /cdn-cgi/trace，返回 trace 字段和各阶段耗时。
+// TCP 连接由本函数建立并计时，TLS 握手和首字节时间通过 httptrace 记录
+func probeOnce(target Target) (trace traceInfo, phases phaseTimings, ok bool) {
+	ipAddr, port := target.IP(), target.Port()
+
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 0,
+	}
+	dialStart := time.Now()
+	conn, err := dialer.Dial("tcp", target.String())
+	if err != nil {
+		return trace, phases, false
+	}
+	defer conn.Close()
+
+	phases.connect = time.Since(dialStart)
+	// 首字节和请求耗时从连接建立后开始计时，HTTPS 下包含 TLS 握手
+	start := time.Now()
+
+	// Host 和 SNI 可通过 -host/-sni 指定，否则使用分享链接中的值，用于测试自己的 Workers/Pages 域名
+	host := probeHost(target)
+	client := http.Client{
+		Transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				return conn, nil
+			},
+			TLSClientConfig: probeTLSConfig(probeSNI(target, host)),
+		},
+		Timeout: timeout,
+	}
+
+	var protocol string
+	if *enableTLS {
+		protocol = "https://"
+	} else {
+		protocol = "http://"
+	}
+	requestURL := protocol + host + "/cdn-cgi/trace"
+
+	req, _ := http.NewRequest("GET", requestURL, nil)
+
+	// 添加用户代理
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	req.Close = true
+	var tlsStart time.Time
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		TLSHandshakeStart: func() {
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			if !tlsStart.IsZero() {
+				phases.tls = time.Since(tlsStart)
+			}
+		},
+		GotFirstResponseByte: func() {
+			phases.ttfb = time.Since(start)
+		},
+	}))
+	resp, err := client.Do(req)
+	if err != nil {
+		return trace, phases, false
+	}
+	defer resp.Body.Close()
+
+	duration := time.Since(start)
+	if duration > maxDuration {
+		return trace, phases, false
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return trace, phases, false
+	}
+	phases.total = time.Since(dialStart)
+
+	// 解析 trace 的全部字段，并与 CF-RAY 响应头中的数据中心对照
+	trace = traceInfo{fields: parseTrace(string(body)), rayColo: cfRayColo(resp.Header.Get("CF-RAY"))}
+	if trace.get("uag") != "Mozilla/5.0" || trace.get("colo") == "" {
+		return trace, phases, false
+	}
+	if trace.coloMismatch() {
+		fmt.Printf("IP %s 端口 %d 的数据中心不一致: trace 为 %s，CF-RAY 为 %s\n", ipAddr, port, trace.get("colo"), trace.rayColo)
+	}
+	return trace, phases, true
+}
+
 // 测速函数
 func getDownloadSpeed(ip string, port int) float64 {
 	var protocol string
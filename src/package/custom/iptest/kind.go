@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// 目标类型
+const (
+	kindOfficial = "official" // Cloudflare 官方节点：地址位于 Cloudflare 公布的 IP 段内
+	kindProxy    = "proxy"    // 反代：第三方主机代为请求 Cloudflare，trace 中的客户端 IP 不是本机出口
+	kindUnknown  = "unknown"  // 无法判断，如透明中转或缺少参照的出口 IP
+)
+
+// kindNames 各类型的显示名称
+var kindNames = map[string]string{
+	kindOfficial: "官方",
+	kindProxy:    "反代",
+	kindUnknown:  "未知",
+}
+
+// kindOrder 报告中各类型的顺序
+var kindOrder = []string{kindOfficial, kindProxy, kindUnknown}
+
+// parseKinds 解析 -kind：逗号分隔的 official、proxy、unknown（或 官方、反代、未知），空表示不过滤
+func parseKinds(spec string) (map[string]bool, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	kinds := make(map[string]bool)
+	for _, k := range strings.Split(spec, ",") {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		found := false
+		for kind, name := range kindNames {
+			if strings.EqualFold(k, kind) || k == name {
+				kinds[kind] = true
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("不支持的类型: %s，可选 official(官方)、proxy(反代)、unknown(未知)", k)
+		}
+	}
+	return kinds, nil
+}
+
+// classifyResults 为每个有效结果标注类型，返回各类型的数量。
+// 地址位于 Cloudflare IP 段内的为官方节点，官方节点 trace 中的客户端 IP 即本机出口，IPv4 和 IPv6 出口分别记录；
+// 其余目标若 trace 中的客户端 IP 就是目标自身，或不是本机同一地址族的出口，说明请求由第三方主机转发，判定为反代。
+// 该地址族没有可参照的出口时判定为未知
+func classifyResults(valid []result) map[string]int {
+	cf := newAddrSet(slices.Clone(cfRanges()))
+	// exits 以是否为 IPv4 区分地址族
+	exits := map[bool]map[netip.Addr]bool{true: {}, false: {}}
+	for i := range valid {
+		addr := valid[i].target.AddrPort.Addr()
+		if valid[i].target.Resolved() && cf.contains(addr) {
+			valid[i].kind = kindOfficial
+			if ip, err := netip.ParseAddr(valid[i].trace.get("ip")); err == nil {
+				ip = ip.Unmap()
+				exits[ip.Is4()][ip] = true
+			}
+		}
+	}
+
+	counts := make(map[string]int)
+	for i := range valid {
+		res := &valid[i]
+		if res.kind == "" {
+			res.kind = kindUnknown
+			if ip, err := netip.ParseAddr(res.trace.get("ip")); err == nil {
+				ip = ip.Unmap()
+				family := exits[ip.Is4()]
+				if ip == res.target.AddrPort.Addr() || len(family) > 0 && !family[ip] {
+					res.kind = kindProxy
+				}
+			}
+		}
+		counts[res.kind]++
+	}
+	return counts
+}
+
+// filterKinds 只保留 -kind 指定类型的结果
+func filterKinds(valid []result, kinds map[string]bool) []result {
+	if kinds == nil {
+		return valid
+	}
+	kept := valid[:0]
+	for _, res := range valid {
+		if kinds[res.kind] {
+			kept = append(kept, res)
+		}
+	}
+	return kept
+}
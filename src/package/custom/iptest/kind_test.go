@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/netip"
+	"testing"
+)
+
+// kindResult 构造带 trace 客户端 IP 的有效结果
+func kindResult(t *testing.T, target, traceIP string) result {
+	t.Helper()
+	res := result{target: addrTarget(netip.MustParseAddr(target), 443)}
+	if traceIP != "" {
+		res.trace.fields = map[string]string{"ip": traceIP}
+	}
+	return res
+}
+
+func TestClassifyResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets [][2]string // 目标地址、trace 中的客户端 IP
+		want    []string
+	}{
+		{
+			name: "exits compared within the same family",
+			targets: [][2]string{
+				{"104.16.1.2", "203.0.113.7"},
+				{"2606:4700::1", "2001:db8::7"},
+				{"1.2.3.4", "203.0.113.7"},    // 透明中转，出口与本机相同
+				{"1.2.3.5", "198.51.100.9"},   // 第三方出口
+				{"5.6.7.8", "2001:db8::7"},    // IPv6 出口与本机相同
+				{"5.6.7.9", "2001:db8::99"},   // 第三方 IPv6 出口
+				{"9.9.9.9", "::ffff:9.9.9.9"}, // 客户端 IP 就是目标自身
+			},
+			want: []string{kindOfficial, kindOfficial, kindUnknown, kindProxy, kindUnknown, kindProxy, kindProxy},
+		},
+		{
+			name: "no exit of the family to compare",
+			targets: [][2]string{
+				{"104.16.1.2", "203.0.113.7"},
+				{"1.2.3.4", "2001:db8::7"},
+				{"2001:db8:1::1", "2001:db8::8"},
+				{"1.2.3.5", ""},
+			},
+			want: []string{kindOfficial, kindUnknown, kindUnknown, kindUnknown},
+		},
+		{
+			name: "target is its own exit without official results",
+			targets: [][2]string{
+				{"1.2.3.4", "1.2.3.4"},
+				{"1.2.3.5", "203.0.113.7"},
+			},
+			want: []string{kindProxy, kindUnknown},
+		},
+	}
+	for _, tt := range tests {
+		var valid []result
+		for _, target := range tt.targets {
+			valid = append(valid, kindResult(t, target[0], target[1]))
+		}
+		counts := classifyResults(valid)
+		want := make(map[string]int)
+		for i, kind := range tt.want {
+			want[kind]++
+			if valid[i].kind != kind {
+				t.Errorf("%s: %s (trace ip %q) = %s, want %s", tt.name, tt.targets[i][0], tt.targets[i][1], valid[i].kind, kind)
+			}
+		}
+		for _, kind := range kindOrder {
+			if counts[kind] != want[kind] {
+				t.Errorf("%s: counts[%s] = %d, want %d", tt.name, kind, counts[kind], want[kind])
+			}
+		}
+	}
+}
+
+func TestParseKinds(t *testing.T) {
+	kinds, err := parseKinds("official, 反代")
+	if err != nil || len(kinds) != 2 || !kinds[kindOfficial] || !kinds[kindProxy] {
+		t.Errorf("parseKinds() = %v, %v", kinds, err)
+	}
+	if kinds, err := parseKinds(" "); kinds != nil || err != nil {
+		t.Errorf("parseKinds(\" \") = %v, %v", kinds, err)
+	}
+	if _, err := parseKinds("official,cdn"); err == nil {
+		t.Error("parseKinds() accepted an unknown kind")
+	}
+}
+
+func TestCFRangesLoadedOnce(t *testing.T) {
+	saved, savedURL := cfRangeCache, *cfURL
+	t.Cleanup(func() { cfRangeCache, *cfURL = saved, savedURL })
+
+	cfRangeCache = nil
+	*cfURL = ""
+	first := cfRanges()
+	if len(first) != len(cfPrefixes) {
+		t.Fatalf("cfRanges() returned %d ranges, want %d", len(first), len(cfPrefixes))
+	}
+	// 之后修改 -cfurl 也不会重新加载
+	*cfURL = "http://127.0.0.1:1/ips"
+	if again := cfRanges(); &again[0] != &first[0] {
+		t.Error("cfRanges() reloaded the ranges")
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// latencyStats 多次探测的延迟统计
+type latencyStats struct {
+	attempts   int           // 探测次数
+	samples    int           // 成功次数
+	min        time.Duration // 最低延迟
+	avg        time.Duration // 平均延迟
+	median     time.Duration // 延迟中位数
+	jitter     time.Duration // 抖动（延迟标准差）
+	loss       float64       // 失败次数占比，0-1
+	colos      []string      // 各次探测到的数据中心（去重）
+	coloStable bool          // 各次探测的数据中心是否相同
+}
+
+// newLatencyStats 由成功探测的延迟和各次的数据中心计算统计，attempts 为总探测次数
+func newLatencyStats(durations []time.Duration, colos []string, attempts int) latencyStats {
+	s := latencyStats{attempts: attempts, samples: len(durations), coloStable: true}
+	if attempts > 0 {
+		s.loss = float64(attempts-len(durations)) / float64(attempts)
+	}
+	for _, colo := range colos {
+		found := false
+		for _, c := range s.colos {
+			found = found || c == colo
+		}
+		if !found {
+			s.colos = append(s.colos, colo)
+		}
+	}
+	s.coloStable = len(s.colos) <= 1
+	if len(durations) == 0 {
+		return s
+	}
+
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	s.min = sorted[0]
+	if n := len(sorted); n%2 == 1 {
+		s.median = sorted[n/2]
+	} else {
+		s.median = (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	var sum float64
+	for _, d := range sorted {
+		sum += float64(d)
+	}
+	mean := sum / float64(len(sorted))
+	s.avg = time.Duration(mean)
+	var variance float64
+	for _, d := range sorted {
+		variance += (float64(d) - mean) * (float64(d) - mean)
+	}
+	s.jitter = time.Duration(math.Sqrt(variance / float64(len(sorted))))
+	return s
+}
+
+// latencyStatsHeader -count 大于1时追加的统计列
+var latencyStatsHeader = []string{"最低延迟", "平均延迟", "抖动", "丢包率", "数据中心稳定"}
+
+// columns 返回统计列的值
+func (s latencyStats) columns() []string {
+	stable := "是"
+	if !s.coloStable {
+		stable = "否(" + strings.Join(s.colos, "/") + ")"
+	}
+	return []string{
+		fmt.Sprintf("%d ms", s.min.Milliseconds()),
+		fmt.Sprintf("%d ms", s.avg.Milliseconds()),
+		fmt.Sprintf("%.1f ms", float64(s.jitter)/float64(time.Millisecond)),
+		fmt.Sprintf("%.0f%%", s.loss*100),
+		stable,
+	}
+}
+
+// acceptable 按 -maxloss 和 -maxjitter 判断结果是否保留，不保留时返回原因
+func (s latencyStats) acceptable() (bool, string) {
+	if s.loss*100 > *maxLoss {
+		return false, fmt.Sprintf("丢包率 %.0f%% 超过 %.0f%%", s.loss*100, *maxLoss)
+	}
+	if *maxJitter > 0 && s.jitter > *maxJitter {
+		return false, fmt.Sprintf("抖动 %v 超过 %v", s.jitter.Round(time.Millisecond/10), *maxJitter)
+	}
+	return true, ""
+}
+
+// 可用于排序的探测阶段
+const (
+	phaseConnect = "connect" // TCP 连接
+	phaseTLS     = "tls"     // TLS 握手
+	phaseTTFB    = "ttfb"    // 首字节：从 TCP 连接建立后（不含拨号）到收到首个响应字节，HTTPS 下包含 TLS 握手
+	phaseTotal   = "total"   // 总耗时：从开始连接到读完响应
+)
+
+// phaseNames 各阶段的显示名称，同时用作输出列名，按输出顺序排列
+var phaseNames = []struct{ key, name string }{
+	{phaseConnect, "TCP连接"},
+	{phaseTLS, "TLS握手"},
+	{phaseTTFB, "首字节"},
+	{phaseTotal, "总耗时"},
+}
+
+// phaseTimings 一次探测各阶段的耗时
+type phaseTimings struct {
+	connect, tls, ttfb, total time.Duration
+}
+
+// get 返回指定阶段的耗时
+func (p phaseTimings) get(phase string) time.Duration {
+	switch phase {
+	case phaseTLS:
+		return p.tls
+	case phaseTTFB:
+		return p.ttfb
+	case phaseTotal:
+		return p.total
+	}
+	return p.connect
+}
+
+// validPhase 检查 -rankby 指定的阶段，未启用 TLS 时不能按 TLS 握手排序
+func validPhase(phase string) error {
+	for _, p := range phaseNames {
+		if p.key == phase {
+			if phase == phaseTLS && !*enableTLS {
+				return fmt.Errorf("未启用TLS时不能按TLS握手时间排序")
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("不支持的排序阶段: %s，可选 connect、tls、ttfb、total", phase)
+}
+
+// phaseName 返回阶段的显示名称
+func phaseName(phase string) string {
+	for _, p := range phaseNames {
+		if p.key == phase {
+			return p.name
+		}
+	}
+	return phase
+}
+
+// medianPhases 返回多次探测中各阶段耗时的中位数
+func medianPhases(samples []phaseTimings) phaseTimings {
+	median := func(phase string) time.Duration {
+		durations := make([]time.Duration, len(samples))
+		for i, s := range samples {
+			durations[i] = s.get(phase)
+		}
+		return newLatencyStats(durations, nil, len(durations)).median
+	}
+	return phaseTimings{
+		connect: median(phaseConnect),
+		tls:     median(phaseTLS),
+		ttfb:    median(phaseTTFB),
+		total:   median(phaseTotal),
+	}
+}
+
+// sortResults 测速时按下载速度从高到低排序，否则按延迟（-rankby 选择的阶段耗时）从低到高排序
+func sortResults(results []speedtestresult) {
+	if *speedTest > 0 {
+		sort.Slice(results, func(i, j int) bool {
+			return results[i].downloadSpeed > results[j].downloadSpeed
+		})
+		return
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].result.tcpDuration < results[j].result.tcpDuration
+	})
+}
+
+// phaseHeader -phases 输出的各阶段耗时列
+func phaseHeader() []string {
+	header := make([]string, len(phaseNames))
+	for i, p := range phaseNames {
+		header[i] = p.name
+	}
+	return header
+}
+
+// columns 返回各阶段耗时列的值，单位毫秒
+func (p phaseTimings) columns() []string {
+	cols := make([]string, len(phaseNames))
+	for i, name := range phaseNames {
+		cols[i] = fmt.Sprintf("%.1f ms", float64(p.get(name.key))/float64(time.Millisecond))
+	}
+	return cols
+}
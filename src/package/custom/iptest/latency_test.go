@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewLatencyStats(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name      string
+		durations []time.Duration
+		colos     []string
+		attempts  int
+		want      latencyStats
+	}{
+		{
+			name:      "odd samples",
+			durations: []time.Duration{30 * ms, 10 * ms, 20 * ms},
+			colos:     []string{"HKG", "HKG", "HKG"},
+			attempts:  3,
+			want: latencyStats{attempts: 3, samples: 3, min: 10 * ms, avg: 20 * ms, median: 20 * ms,
+				jitter: 8164965 * time.Nanosecond, colos: []string{"HKG"}, coloStable: true},
+		},
+		{
+			name:      "even samples with loss",
+			durations: []time.Duration{40 * ms, 10 * ms},
+			colos:     []string{"HKG", "NRT"},
+			attempts:  4,
+			want: latencyStats{attempts: 4, samples: 2, min: 10 * ms, avg: 25 * ms, median: 25 * ms,
+				jitter: 15 * ms, loss: 0.5, colos: []string{"HKG", "NRT"}},
+		},
+		{
+			name:     "all failed",
+			attempts: 2,
+			want:     latencyStats{attempts: 2, loss: 1, coloStable: true},
+		},
+	}
+	for _, tt := range tests {
+		got := newLatencyStats(tt.durations, tt.colos, tt.attempts)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: newLatencyStats() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLatencyStatsAcceptable(t *testing.T) {
+	oldLoss, oldJitter := *maxLoss, *maxJitter
+	defer func() { *maxLoss, *maxJitter = oldLoss, oldJitter }()
+	*maxLoss, *maxJitter = 25, 5*time.Millisecond
+
+	tests := []struct {
+		stats latencyStats
+		want  bool
+	}{
+		{latencyStats{loss: 0.25, jitter: 5 * time.Millisecond}, true},
+		{latencyStats{loss: 0.5}, false},
+		{latencyStats{jitter: 6 * time.Millisecond}, false},
+	}
+	for _, tt := range tests {
+		if got, reason := tt.stats.acceptable(); got != tt.want {
+			t.Errorf("acceptable(%+v) = %v (%s), want %v", tt.stats, got, reason, tt.want)
+		}
+	}
+}
+
+// stubTraceServer 返回模拟 /cdn-cgi/trace 的服务器，fail 返回 true 的请求得到无效响应
+func stubTraceServer(t *testing.T, fail func(n int64) bool) (Target, *atomic.Int64) {
+	t.Helper()
+	var requests atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		if fail(n) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("CF-RAY", fmt.Sprintf("8c1d2e3f4a5b6c%02d-HKG", n))
+		fmt.Fprintf(w, "fl=%d\nip=192.0.2.1\nuag=%s\ncolo=HKG\n", n, r.UserAgent())
+	}))
+	t.Cleanup(srv.Close)
+	addr := netip.MustParseAddrPort(srv.Listener.Addr().String())
+	return addrTarget(addr.Addr(), int(addr.Port())), &requests
+}
+
+// withProbeFlags 设置探测相关参数，测试结束后恢复
+func withProbeFlags(t *testing.T, count int, loss float64) {
+	t.Helper()
+	oldTLS, oldCount, oldGap, oldLoss, oldJitter := *enableTLS, *probeCount, *probeGap, *maxLoss, *maxJitter
+	*enableTLS, *probeCount, *probeGap, *maxLoss, *maxJitter = false, count, 0, loss, 0
+	t.Cleanup(func() {
+		*enableTLS, *probeCount, *probeGap, *maxLoss, *maxJitter = oldTLS, oldCount, oldGap, oldLoss, oldJitter
+	})
+}
+
+func TestProbeTargetCountsEveryAttempt(t *testing.T) {
+	withProbeFlags(t, 4, 100)
+	// 首次探测失败不会放弃目标，其余探测照常进行并计入丢包率
+	target, requests := stubTraceServer(t, func(n int64) bool { return n == 1 })
+	res, ok := probeTarget(target, nil)
+	if !ok {
+		t.Fatal("target rejected after a failed first attempt")
+	}
+	if requests.Load() != 4 {
+		t.Errorf("made %d attempts, want 4", requests.Load())
+	}
+	if res.stats.attempts != 4 || res.stats.samples != 3 || res.stats.loss != 0.25 {
+		t.Errorf("stats = %+v, want 3 of 4 samples and 25%% loss", res.stats)
+	}
+	if res.trace.get("fl") != "2" || res.dataCenter != "HKG" {
+		t.Errorf("trace taken from request %s, want the first successful one (2)", res.trace.get("fl"))
+	}
+}
+
+func TestProbeTargetRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		loss float64
+		fail func(n int64) bool
+	}{
+		{"all attempts failed", 100, func(int64) bool { return true }},
+		{"loss above -maxloss", 20, func(n int64) bool { return n == 1 }},
+	}
+	for _, tt := range tests {
+		withProbeFlags(t, 4, tt.loss)
+		target, requests := stubTraceServer(t, tt.fail)
+		if _, ok := probeTarget(target, nil); ok {
+			t.Errorf("%s: target accepted", tt.name)
+		}
+		if requests.Load() != 4 {
+			t.Errorf("%s: made %d attempts, want 4", tt.name, requests.Load())
+		}
+	}
+}
+
+// TestProbePhasesTLS 对 HTTPS 服务器分别记录 TCP 连接、TLS 握手、首字节和总耗时，延迟取 -rankby 选择的阶段
+func TestProbePhasesTLS(t *testing.T) {
+	withProbeFlags(t, 1, 0)
+	insecure, rank := *insecureTLS, *rankBy
+	t.Cleanup(func() { *insecureTLS, *rankBy = insecure, rank })
+	*enableTLS, *insecureTLS = true, true
+
+	const delay = 50 * time.Millisecond
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		fmt.Fprintf(w, "ip=192.0.2.1\nuag=%s\ncolo=HKG\n", r.UserAgent())
+	}))
+	defer srv.Close()
+	addr := netip.MustParseAddrPort(srv.Listener.Addr().String())
+	target := addrTarget(addr.Addr(), int(addr.Port()))
+
+	for _, phase := range []string{phaseConnect, phaseTLS, phaseTTFB, phaseTotal} {
+		*rankBy = phase
+		res, ok := probeTarget(target, nil)
+		if !ok {
+			t.Fatalf("-rankby %s: probe failed", phase)
+		}
+		p := res.phases
+		// 首字节从连接建立后计时，包含 TLS 握手和服务器处理时间，不含 TCP 连接
+		if p.connect <= 0 || p.tls <= 0 || p.ttfb < delay+p.tls || p.total < p.connect+p.ttfb || p.connect >= delay {
+			t.Errorf("-rankby %s: phases = %+v", phase, p)
+		}
+		if res.tcpDuration != p.get(phase) {
+			t.Errorf("-rankby %s: latency %v, want %v", phase, res.tcpDuration, p.get(phase))
+		}
+	}
+}
+
+func TestSortResultsByPhase(t *testing.T) {
+	ms := time.Millisecond
+	speed, rank := *speedTest, *rankBy
+	t.Cleanup(func() { *speedTest, *rankBy = speed, rank })
+	*speedTest = 0
+
+	// a 连接最快但首字节最慢，c 相反
+	phases := map[string]phaseTimings{
+		"a": {connect: 5 * ms, tls: 30 * ms, ttfb: 200 * ms, total: 210 * ms},
+		"b": {connect: 20 * ms, tls: 20 * ms, ttfb: 100 * ms, total: 130 * ms},
+		"c": {connect: 40 * ms, tls: 10 * ms, ttfb: 50 * ms, total: 95 * ms},
+	}
+	tests := []struct {
+		phase string
+		want  string
+	}{
+		{phaseConnect, "abc"},
+		{phaseTLS, "cba"},
+		{phaseTTFB, "cba"},
+		{phaseTotal, "cba"},
+	}
+	for _, tt := range tests {
+		*rankBy = tt.phase
+		var results []speedtestresult
+		for _, name := range []string{"b", "a", "c"} {
+			p := phases[name]
+			results = append(results, speedtestresult{result: result{dataCenter: name, phases: p, tcpDuration: p.get(*rankBy)}})
+		}
+		sortResults(results)
+		got := ""
+		for _, res := range results {
+			got += res.dataCenter
+		}
+		if got != tt.want {
+			t.Errorf("-rankby %s: order %s, want %s", tt.phase, got, tt.want)
+		}
+	}
+
+	*speedTest = 5
+	results := []speedtestresult{{downloadSpeed: 1}, {downloadSpeed: 30}, {downloadSpeed: 12}}
+	sortResults(results)
+	if results[0].downloadSpeed != 30 || results[2].downloadSpeed != 1 {
+		t.Errorf("with -speedtest results sorted as %+v", results)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// 逐行解析时命中的格式名称，用于 parse 子命令的诊断输出
+const (
+	formatRange      = "CIDR/IP段"
+	formatPortList   = "端口列表"
+	formatProxyAt    = "代理链接(@主机:端口)"
+	formatHostColon  = "主机:端口"
+	formatHostSpace  = "主机 端口"
+	formatHostOnly   = "仅主机(默认443)"
+	formatOpenTCP    = "open tcp"
+	formatIPPipe     = "IP:端口 |"
+	formatJSONLine   = "JSON"
+	formatColonSep   = "冒号分隔"
+	formatFullColon  = "全角冒号分隔"
+	formatCommaSep   = "逗号分隔"
+	formatSpaceSep   = "空格分隔"
+	formatCSV        = "CSV"
+	formatUnresolved = "无法识别"
+)
+
+// maxDiagTargets 每行诊断记录中最多列出的目标数，超出部分只计数
+const maxDiagTargets = 16
+
+// parseDiag 在 parse 子命令中收集逐行诊断信息，正常运行时为 nil，所有方法均可在 nil 上调用
+var parseDiag *parseDiagnostics
+
+// lineDiag 单行（或整体解析的单个文件）的诊断记录
+type lineDiag struct {
+	Type        string   `json:"type"`
+	File        string   `json:"file"`
+	Line        int      `json:"line"` // 整体解析的文件为 0
+	Text        string   `json:"text,omitempty"`
+	Format      string   `json:"format,omitempty"`
+	Targets     []string `json:"targets,omitempty"`
+	TargetCount int      `json:"target_count"`
+	Reason      string   `json:"reason,omitempty"` // 跳过原因
+	Note        string   `json:"note,omitempty"`
+}
+
+// parseTotals 按文件或格式汇总的统计
+type parseTotals struct {
+	Name     string `json:"name"`
+	Lines    int    `json:"lines"`
+	Matched  int    `json:"matched"`
+	Rejected int    `json:"rejected"`
+	Targets  int    `json:"targets"`
+}
+
+// parseDiagnostics 逐行诊断的收集与输出，human 格式每行一条，JSON 格式为 JSON Lines，最后输出汇总
+type parseDiagnostics struct {
+	jsonOut bool
+	w       *bufio.Writer
+
+	file    string
+	cur     *lineDiag
+	files   map[string]*parseTotals
+	formats map[string]*parseTotals
+}
+
+// newParseDiagnostics 创建输出到 w 的诊断收集器
+func newParseDiagnostics(w io.Writer, jsonOut bool) *parseDiagnostics {
+	return &parseDiagnostics{
+		jsonOut: jsonOut,
+		w:       bufio.NewWriter(w),
+		files:   make(map[string]*parseTotals),
+		formats: make(map[string]*parseTotals),
+	}
+}
+
+// startFile 开始解析一个文件
+func (d *parseDiagnostics) startFile(path string) {
+	if d == nil {
+		return
+	}
+	d.end()
+	d.file = path
+	d.totals(d.files, path)
+}
+
+// begin 开始记录一行（或整体解析的文件，lineNo 为 0）
+func (d *parseDiagnostics) begin(lineNo int, text string) {
+	if d == nil {
+		return
+	}
+	d.end()
+	d.cur = &lineDiag{Type: "line", File: d.file, Line: lineNo, Text: text}
+}
+
+// match 记录当前行命中的格式
+func (d *parseDiagnostics) match(format string) {
+	if d == nil || d.cur == nil {
+		return
+	}
+	d.cur.Format = format
+}
+
+// note 为当前行追加说明
+func (d *parseDiagnostics) note(note string) {
+	if d == nil || d.cur == nil {
+		return
+	}
+	d.cur.Note = note
+}
+
+// reject 记录当前行被跳过的原因
+func (d *parseDiagnostics) reject(reason string) {
+	if d == nil || d.cur == nil {
+		return
+	}
+	d.cur.Reason = reason
+}
+
+// target 记录生成的目标；不属于任何行的目标（读完文件后展开的 CIDR/IP段）计入文件和 CIDR/IP段 汇总
+func (d *parseDiagnostics) target(target Target) {
+	if d == nil {
+		return
+	}
+	if d.cur == nil {
+		d.totals(d.files, d.file).Targets++
+		d.totals(d.formats, formatRange).Targets++
+		return
+	}
+	d.cur.TargetCount++
+	if len(d.cur.Targets) < maxDiagTargets {
+		desc := target.String()
+		if target.Tag != "" {
+			desc += " #" + target.Tag
+		}
+		d.cur.Targets = append(d.cur.Targets, desc)
+	}
+}
+
+// end 结束当前行，输出记录并累计汇总
+func (d *parseDiagnostics) end() {
+	if d == nil || d.cur == nil {
+		return
+	}
+	rec := d.cur
+	d.cur = nil
+	if rec.Format == "" && rec.Reason == "" {
+		rec.Reason = "无法解析"
+	}
+
+	file := d.totals(d.files, rec.File)
+	format := d.totals(d.formats, firstNonEmpty(rec.Format, formatUnresolved))
+	for _, t := range []*parseTotals{file, format} {
+		t.Lines++
+		t.Targets += rec.TargetCount
+		if rec.Reason != "" {
+			t.Rejected++
+		} else {
+			t.Matched++
+		}
+	}
+
+	if d.jsonOut {
+		data, _ := json.Marshal(rec)
+		d.w.Write(data)
+		d.w.WriteByte('\n')
+		return
+	}
+	location := fmt.Sprintf("%s:%d", rec.File, rec.Line)
+	if rec.Line == 0 {
+		location = rec.File
+	}
+	if rec.Reason != "" {
+		fmt.Fprintf(d.w, "%s ✗ [%s] 跳过: %s | %s\n", location, firstNonEmpty(rec.Format, formatUnresolved), rec.Reason, rec.Text)
+		return
+	}
+	targets := strings.Join(rec.Targets, ", ")
+	if rec.TargetCount > len(rec.Targets) {
+		targets += fmt.Sprintf(" 等 %d 个", rec.TargetCount)
+	}
+	if rec.Note != "" {
+		targets = strings.TrimPrefix(targets+" ("+rec.Note+")", " ")
+	}
+	fmt.Fprintf(d.w, "%s ✓ [%s] → %s\n", location, rec.Format, targets)
+}
+
+// totals 返回名称对应的汇总项，不存在时创建
+func (d *parseDiagnostics) totals(m map[string]*parseTotals, name string) *parseTotals {
+	t, ok := m[name]
+	if !ok {
+		t = &parseTotals{Name: name}
+		m[name] = t
+	}
+	return t
+}
+
+// finish 输出按文件和按格式的汇总
+func (d *parseDiagnostics) finish() {
+	d.end()
+	defer d.w.Flush()
+
+	files := sortedTotals(d.files)
+	formats := sortedTotals(d.formats)
+	if d.jsonOut {
+		data, _ := json.Marshal(struct {
+			Type    string         `json:"type"`
+			Files   []*parseTotals `json:"files"`
+			Formats []*parseTotals `json:"formats"`
+		}{"summary", files, formats})
+		d.w.Write(data)
+		d.w.WriteByte('\n')
+		return
+	}
+
+	var sum parseTotals
+	fmt.Fprintf(d.w, "\n按文件统计:\n")
+	for _, t := range files {
+		fmt.Fprintf(d.w, "  %s: 行 %d，识别 %d，跳过 %d，目标 %d\n", t.Name, t.Lines, t.Matched, t.Rejected, t.Targets)
+		sum.Lines += t.Lines
+		sum.Matched += t.Matched
+		sum.Rejected += t.Rejected
+		sum.Targets += t.Targets
+	}
+	fmt.Fprintf(d.w, "按格式统计:\n")
+	for _, t := range formats {
+		fmt.Fprintf(d.w, "  %s: 行 %d，目标 %d\n", t.Name, t.Lines, t.Targets)
+	}
+	fmt.Fprintf(d.w, "合计: 行 %d，识别 %d，跳过 %d，目标 %d\n", sum.Lines, sum.Matched, sum.Rejected, sum.Targets)
+}
+
+// sortedTotals 按名称排序汇总项
+func sortedTotals(m map[string]*parseTotals) []*parseTotals {
+	list := make([]*parseTotals, 0, len(m))
+	for _, t := range m {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// skipLine 提示跳过无效行，parse 子命令下同时记录原因
+func skipLine(reason, line string) {
+	fmt.Printf("跳过无效行(%s): %s\n", reason, line)
+	parseDiag.reject(reason)
+}
+
+// runParse 实现 parse 子命令：只解析 -path 中的所有来源，不进行端口处理、域名解析和探测，
+// 远程源只使用本地缓存。诊断结果输出到标准输出，其余提示信息改为输出到标准错误
+func runParse(args []string) {
+	flag.CommandLine.Parse(args)
+	offlineMode = true
+
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	parseDiag = newParseDiagnostics(stdout, *parseJSON)
+	if err := applyUCISources(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// 目标已在 readIPsFromFile 中记录，这里无需处理
+	_, err := readSources(*Path, func(Target) {})
+	parseDiag.finish()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取 IP 时出错: %v\n", err)
+		os.Exit(1)
+	}
+}
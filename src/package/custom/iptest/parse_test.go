@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// runParseCapture 运行 parse 子命令并返回诊断输出
+func runParseCapture(t *testing.T, args ...string) string {
+	t.Helper()
+	withPipelineFlags(t)
+	jsonOut, offline, diag, stdout := *parseJSON, offlineMode, parseDiag, os.Stdout
+	t.Cleanup(func() { *parseJSON, offlineMode, parseDiag, os.Stdout = jsonOut, offline, diag, stdout })
+
+	out, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	os.Stdout = out
+	runParse(args)
+	os.Stdout = stdout
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// parseTestDir 写入一个文本文件和一个 Clash 配置
+func parseTestDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"ip.txt": strings.Join([]string{
+			"1.1.1.1 443",
+			"1.0.0.1:2053 #香港",
+			"104.16.0.0/30 2053",
+			"# comment",
+			"not a host!",
+			"2606:4700::1 8443",
+			"vless://uuid@cdn.example.com:443?security=tls&sni=sni.example.com#节点",
+		}, "\n"),
+		"nodes.yaml": "proxies:\n  - name: a\n    type: vless\n    server: 104.17.0.1\n    port: 443\n  - name: b\n    type: trojan\n    server: cdn.example.com\n    port: 2053\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRunParseJSON(t *testing.T) {
+	dir := parseTestDir(t)
+	out := runParseCapture(t, "-path", dir, "-json")
+	txt, yaml := filepath.Join(dir, "ip.txt"), filepath.Join(dir, "nodes.yaml")
+
+	var lines []lineDiag
+	var summary struct {
+		Type    string        `json:"type"`
+		Files   []parseTotals `json:"files"`
+		Formats []parseTotals `json:"formats"`
+	}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		var rec lineDiag
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		if rec.Type == "summary" {
+			json.Unmarshal(scanner.Bytes(), &summary)
+			continue
+		}
+		lines = append(lines, rec)
+	}
+
+	want := []lineDiag{
+		{Type: "line", File: txt, Line: 1, Text: "1.1.1.1 443", Format: formatHostSpace, Targets: []string{"1.1.1.1:443"}, TargetCount: 1},
+		{Type: "line", File: txt, Line: 2, Text: "1.0.0.1:2053 #香港", Format: formatHostColon, Targets: []string{"1.0.0.1:2053 #香港"}, TargetCount: 1},
+		{Type: "line", File: txt, Line: 3, Text: "104.16.0.0/30 2053", Format: formatRange, Note: "读取结束后合并展开"},
+		{Type: "line", File: txt, Line: 5, Text: "not a host!", Format: formatSpaceSep, Reason: "端口无效"},
+		{Type: "line", File: txt, Line: 6, Text: "2606:4700::1 8443", Format: formatHostSpace, Targets: []string{"[2606:4700::1]:8443"}, TargetCount: 1},
+		{Type: "line", File: txt, Line: 7, Text: "vless://uuid@cdn.example.com:443?security=tls&sni=sni.example.com#节点",
+			Format: "分享链接(vless)", Targets: []string{"cdn.example.com:443 #节点"}, TargetCount: 1},
+		{Type: "line", File: yaml, Format: "Clash/Mihomo配置", Targets: []string{"104.17.0.1:443 #a", "cdn.example.com:2053 #b"}, TargetCount: 2},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d line records, want %d:\n%s", len(lines), len(want), out)
+	}
+	for i := range want {
+		got := lines[i]
+		if got.File != want[i].File || got.Line != want[i].Line || got.Text != want[i].Text || got.Format != want[i].Format ||
+			!slices.Equal(got.Targets, want[i].Targets) || got.TargetCount != want[i].TargetCount ||
+			got.Reason != want[i].Reason || got.Note != want[i].Note {
+			t.Errorf("record %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	// 文本文件的 CIDR 读完后展开的 4 个目标计入文件和 CIDR/IP段 汇总
+	wantFiles := []parseTotals{
+		{Name: txt, Lines: 6, Matched: 5, Rejected: 1, Targets: 8},
+		{Name: yaml, Lines: 1, Matched: 1, Targets: 2},
+	}
+	wantFormats := []parseTotals{
+		{Name: formatRange, Lines: 1, Matched: 1, Targets: 4},
+		{Name: "Clash/Mihomo配置", Lines: 1, Matched: 1, Targets: 2},
+		{Name: formatHostSpace, Lines: 2, Matched: 2, Targets: 2},
+		{Name: formatHostColon, Lines: 1, Matched: 1, Targets: 1},
+		{Name: "分享链接(vless)", Lines: 1, Matched: 1, Targets: 1},
+		{Name: formatSpaceSep, Lines: 1, Rejected: 1},
+	}
+	if summary.Type != "summary" || !slices.Equal(summary.Files, wantFiles) || !slices.Equal(summary.Formats, wantFormats) {
+		t.Errorf("summary = %+v, want files %+v, formats %+v", summary, wantFiles, wantFormats)
+	}
+}
+
+func TestRunParseHuman(t *testing.T) {
+	dir := parseTestDir(t)
+	out := runParseCapture(t, "-path", filepath.Join(dir, "ip.txt"))
+	for _, want := range []string{
+		filepath.Join(dir, "ip.txt") + ":2 ✓ [主机:端口] → 1.0.0.1:2053 #香港\n",
+		filepath.Join(dir, "ip.txt") + ":5 ✗ [空格分隔] 跳过: 端口无效 | not a host!\n",
+		"  CIDR/IP段: 行 1，目标 4\n",
+		"合计: 行 6，识别 5，跳过 1，目标 8\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("parse output missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "nodes.yaml") || strings.Contains(out, "{") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"hash/maphash"
+	"math"
+	"net/netip"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// targetStage 对读取到的每个目标依次执行 -testports 端口组合、-ports 端口过滤和域名解析，
+// 可被多个协程并发调用
+type targetStage struct {
+	testPorts []int
+	portList  []int // -ports 指定的端口
+	allowed   map[int]bool
+	resolvers []dnsResolver
+	exclude   *addrSet // -exclude 排除列表
+	bogons    *addrSet // 内置非公网地址，-bogon=false 时为空
+
+	mu       sync.Mutex
+	resolved map[string]*resolvedDomain
+
+	filtered atomic.Int64 // 被 -ports 过滤的目标数
+	excluded atomic.Int64 // 命中排除列表的目标数
+	bogon    atomic.Int64 // 非公网地址的目标数
+}
+
+// resolvedDomain 缓存单个域名的解析结果，同一域名只解析一次
+type resolvedDomain struct {
+	once  sync.Once
+	addrs []netip.Addr
+}
+
+// newTargetStage 根据 -testports、-ports、-resolver 参数创建处理阶段
+func newTargetStage() (*targetStage, error) {
+	stage := &targetStage{resolved: make(map[string]*resolvedDomain)}
+	if *testPorts != "" {
+		portList, err := parsePortSpec(*testPorts)
+		if err != nil {
+			return nil, fmt.Errorf("-testports 参数无效: %w", err)
+		}
+		stage.testPorts = portList
+	}
+	if *ports != "" {
+		portList, err := parsePortSpec(*ports)
+		if err != nil {
+			return nil, fmt.Errorf("-ports 参数无效: %w", err)
+		}
+		stage.portList = portList
+		stage.allowed = make(map[int]bool, len(portList))
+		for _, p := range portList {
+			stage.allowed[p] = true
+		}
+	}
+	resolvers, err := newDNSResolvers(*resolverSpec)
+	if err != nil {
+		return nil, fmt.Errorf("-resolver 参数无效: %w", err)
+	}
+	stage.resolvers = resolvers
+	if *exclude != "" {
+		if stage.exclude, err = readExcludeList(*exclude); err != nil {
+			return nil, err
+		}
+	}
+	if *filterBogon {
+		stage.bogons = bogonSet()
+	}
+	return stage, nil
+}
+
+// process 处理单个目标，生成的目标交给 emit
+func (s *targetStage) process(t Target, emit func(Target)) {
+	portList := []int{t.Port()}
+	if s.testPorts != nil {
+		portList = s.testPorts
+	}
+
+	var addrs []netip.Addr
+	isDomain := false
+	if t.Resolved() {
+		if !s.allowAddr(t.AddrPort.Addr()) {
+			return
+		}
+	} else if s.resolvers != nil {
+		isDomain = true
+		for _, addr := range s.resolve(t.Hostname) {
+			if s.allowAddr(addr) {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+
+	for _, p := range portList {
+		if s.allowed != nil && !s.allowed[p] {
+			s.filtered.Add(1)
+			continue
+		}
+		if !isDomain {
+			emit(t.withPort(p))
+			continue
+		}
+		for _, addr := range addrs {
+			emit(t.withPort(p).withAddr(addr))
+		}
+	}
+}
+
+// allowAddr 判断地址是否未被排除列表和非公网地址过滤，并统计被排除的数量
+func (s *targetStage) allowAddr(addr netip.Addr) bool {
+	if s.exclude.contains(addr) {
+		s.excluded.Add(1)
+		return false
+	}
+	if s.bogons.contains(addr) {
+		s.bogon.Add(1)
+		return false
+	}
+	return true
+}
+
+// resolve 解析域名为全部 A/AAAA 记录，结果按域名缓存
+func (s *targetStage) resolve(domain string) []netip.Addr {
+	s.mu.Lock()
+	entry, ok := s.resolved[domain]
+	if !ok {
+		entry = &resolvedDomain{}
+		s.resolved[domain] = entry
+	}
+	s.mu.Unlock()
+
+	entry.once.Do(func() {
+		addrs, err := resolveDomain(s.resolvers, domain)
+		if err != nil {
+			fmt.Printf("域名 %s 解析失败: %v，已跳过\n", domain, err)
+			return
+		}
+		entry.addrs = addrs
+	})
+	return entry.addrs
+}
+
+// resolveStats 返回已解析的域名数和解析出的地址总数
+func (s *targetStage) resolveStats() (domains, addrs int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.resolved {
+		if len(entry.addrs) > 0 {
+			domains++
+			addrs += len(entry.addrs)
+		}
+	}
+	return domains, addrs
+}
+
+// sourceTargetCounts 每个来源去重后送去测试的目标数，由 readIPs 写入，读取结束后用于报告
+var sourceTargetCounts = make(map[string]int)
+
+const (
+	dedupEntryBytes = 96 // 精确集合中每个条目的估算内存占用
+	bloomHashes     = 7  // 布隆过滤器哈希函数个数
+)
+
+// dedupFilter 按目标的 IP:端口 去重。条目较少时使用精确集合，超过 -dedupmem 内存预算后
+// 切换为同样大小的布隆过滤器，内存固定，代价是极少量未重复的目标可能被误判为重复而跳过
+type dedupFilter struct {
+	exact    map[string]struct{}
+	maxExact int
+
+	bits         []uint64
+	seed1, seed2 maphash.Seed
+	count        int // 已加入的条目数
+}
+
+// newDedupFilter 创建内存上限为 memMB 的去重过滤器
+func newDedupFilter(memMB int) *dedupFilter {
+	budget := max(memMB, 1) << 20
+	return &dedupFilter{
+		exact:    make(map[string]struct{}),
+		maxExact: budget / dedupEntryBytes,
+		seed1:    maphash.MakeSeed(),
+		seed2:    maphash.MakeSeed(),
+	}
+}
+
+// add 加入一个键，返回该键此前是否未出现过
+func (f *dedupFilter) add(key string) bool {
+	if f.bits == nil {
+		if _, ok := f.exact[key]; ok {
+			return false
+		}
+		f.exact[key] = struct{}{}
+		f.count++
+		if len(f.exact) >= f.maxExact {
+			f.switchToBloom()
+		}
+		return true
+	}
+
+	h1 := maphash.String(f.seed1, key)
+	h2 := maphash.String(f.seed2, key) | 1
+	m := uint64(len(f.bits)) * 64
+	seen := true
+	for i := uint64(0); i < bloomHashes; i++ {
+		idx := (h1 + i*h2) % m
+		word, bit := idx/64, uint64(1)<<(idx%64)
+		if f.bits[word]&bit == 0 {
+			seen = false
+			f.bits[word] |= bit
+		}
+	}
+	if !seen {
+		f.count++
+	}
+	return !seen
+}
+
+// switchToBloom 将精确集合中的条目迁移到布隆过滤器并释放集合
+func (f *dedupFilter) switchToBloom() {
+	words := f.maxExact * dedupEntryBytes / 8
+	fmt.Printf("去重条目超过 %d 条 (内存上限 %d MB)，改用布隆过滤器去重\n", f.maxExact, *dedupMem)
+	f.bits = make([]uint64, words)
+	keys := f.exact
+	f.exact = nil
+	f.count = 0
+	for key := range keys {
+		f.add(key)
+	}
+}
+
+// falsePositiveRate 估算布隆过滤器当前的误判率，使用精确集合时为 0
+func (f *dedupFilter) falsePositiveRate() float64 {
+	if f.bits == nil {
+		return 0
+	}
+	m := float64(len(f.bits) * 64)
+	return math.Pow(1-math.Exp(-bloomHashes*float64(f.count)/m), bloomHashes)
+}
+
+// sourceStat 单个来源的测试统计
+type sourceStat struct {
+	source      string
+	targets     int           // 送去测试的目标数
+	valid       int           // 有效IP数
+	bestLatency time.Duration // 最低延迟
+}
+
+// sourceStats 按来源汇总目标数、有效数和最低延迟，有效数多的来源排在前面
+func sourceStats(results []speedtestresult) []sourceStat {
+	stats := make(map[string]*sourceStat, len(sourceTargetCounts))
+	for source, n := range sourceTargetCounts {
+		stats[source] = &sourceStat{source: source, targets: n}
+	}
+	for _, res := range results {
+		stat, ok := stats[res.result.target.Source]
+		if !ok {
+			continue
+		}
+		if stat.valid == 0 || res.result.tcpDuration < stat.bestLatency {
+			stat.bestLatency = res.result.tcpDuration
+		}
+		stat.valid++
+	}
+	list := make([]sourceStat, 0, len(stats))
+	for _, stat := range stats {
+		list = append(list, *stat)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].valid != list[j].valid {
+			return list[i].valid > list[j].valid
+		}
+		return list[i].source < list[j].source
+	})
+	return list
+}
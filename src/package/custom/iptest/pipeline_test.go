@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// withPipelineFlags 将读取流水线相关的参数设为不解析、不过滤，测试结束后恢复
+func withPipelineFlags(t *testing.T) {
+	t.Helper()
+	path, resolver, testPortSpec, portSpec, excludeSpec := *Path, *resolverSpec, *testPorts, *ports, *exclude
+	gen, search, bogon, capPerSource, mem := *genFamilies, *searchSpec, *filterBogon, *sourceMax, *dedupMem
+	savedShard, counts, stdin := shard, sourceTargetCounts, os.Stdin
+	t.Cleanup(func() {
+		*Path, *resolverSpec, *testPorts, *ports, *exclude = path, resolver, testPortSpec, portSpec, excludeSpec
+		*genFamilies, *searchSpec, *filterBogon, *sourceMax, *dedupMem = gen, search, bogon, capPerSource, mem
+		shard, sourceTargetCounts, os.Stdin = savedShard, counts, stdin
+	})
+	*resolverSpec, *testPorts, *ports, *exclude, *genFamilies, *searchSpec = "none", "", "", "", "", ""
+	*filterBogon, *sourceMax, *dedupMem = true, 0, 16
+	shard, sourceTargetCounts = shardInfo{}, make(map[string]int)
+}
+
+// runReadIPs 运行 readIPs 并收集送去测试的目标
+func runReadIPs(t *testing.T, path string) (targets []Target, total int, err error) {
+	t.Helper()
+	out := make(chan Target)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		total, err = readIPs(path, out)
+	}()
+	for target := range out {
+		targets = append(targets, target)
+	}
+	<-done
+	return targets, total, err
+}
+
+func TestDedupFilter(t *testing.T) {
+	f := newDedupFilter(1)
+	f.maxExact = 4
+	for _, key := range []string{"1.1.1.1:443", "1.1.1.2:443", "[2606:4700::1]:443"} {
+		if !f.add(key) {
+			t.Errorf("add(%s) = false for a new key", key)
+		}
+	}
+	if f.add("1.1.1.1:443") {
+		t.Error("duplicate accepted in exact mode")
+	}
+	if f.bits != nil || f.falsePositiveRate() != 0 {
+		t.Errorf("exact mode: bits = %d words, falsePositiveRate = %v", len(f.bits), f.falsePositiveRate())
+	}
+
+	// 第 4 个条目达到上限，切换为布隆过滤器，已有条目迁移过去
+	if !f.add("1.1.1.3:443") {
+		t.Error("add() = false for a new key at the switch")
+	}
+	if f.bits == nil || f.exact != nil {
+		t.Fatal("filter did not switch to the bloom filter")
+	}
+	for _, key := range []string{"1.1.1.1:443", "1.1.1.2:443", "[2606:4700::1]:443", "1.1.1.3:443"} {
+		if f.add(key) {
+			t.Errorf("migrated key %s accepted again", key)
+		}
+	}
+	if !f.add("1.1.1.4:443") || f.add("1.1.1.4:443") {
+		t.Error("bloom filter did not reject a duplicate added after the switch")
+	}
+	if f.count != 5 {
+		t.Errorf("count = %d, want 5", f.count)
+	}
+	if rate := f.falsePositiveRate(); rate <= 0 || rate > 1e-6 {
+		t.Errorf("falsePositiveRate = %v", rate)
+	}
+}
+
+func TestTargetStageProcess(t *testing.T) {
+	var lookups atomic.Int32
+	stage := &targetStage{
+		testPorts: []int{443, 2053},
+		allowed:   map[int]bool{443: true},
+		exclude:   newAddrSet([]ipRange{{start: netip.MustParseAddr("8.8.8.0"), end: netip.MustParseAddr("8.8.8.255")}}),
+		bogons:    bogonSet(),
+		resolved:  make(map[string]*resolvedDomain),
+		resolvers: []dnsResolver{{name: "stub", lookup: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			lookups.Add(1)
+			if host != "cdn.example.com" {
+				return nil, fmt.Errorf("NXDOMAIN")
+			}
+			return []netip.Addr{netip.MustParseAddr("104.16.1.2"), netip.MustParseAddr("10.0.0.2"), netip.MustParseAddr("2606:4700::1")}, nil
+		}}},
+	}
+
+	var got []string
+	emit := func(target Target) {
+		got = append(got, target.String()+" "+target.Hostname)
+	}
+	inputs := []struct {
+		host string
+		port int
+	}{{"1.1.1.1", 80}, {"10.0.0.1", 443}, {"8.8.8.8", 443}, {"cdn.example.com", 80}, {"cdn.example.com", 8443}, {"nx.example.com", 443}}
+	for _, in := range inputs {
+		target, err := newTarget(in.host, in.port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stage.process(target, emit)
+	}
+	want := []string{
+		"1.1.1.1:443 ",
+		"104.16.1.2:443 cdn.example.com", "[2606:4700::1]:443 cdn.example.com",
+		"104.16.1.2:443 cdn.example.com", "[2606:4700::1]:443 cdn.example.com",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("process() emitted %q, want %q", got, want)
+	}
+	// 未被排除的目标（包括解析失败的域名）的 2053 端口都被 -ports 过滤
+	if stage.filtered.Load() != 4 || stage.excluded.Load() != 1 || stage.bogon.Load() != 3 {
+		t.Errorf("filtered %d, excluded %d, bogon %d, want 4, 1, 3", stage.filtered.Load(), stage.excluded.Load(), stage.bogon.Load())
+	}
+	if lookups.Load() != 2 {
+		t.Errorf("resolver called %d times, want once per domain", lookups.Load())
+	}
+	if domains, addrs := stage.resolveStats(); domains != 1 || addrs != 3 {
+		t.Errorf("resolveStats() = %d, %d, want 1, 3", domains, addrs)
+	}
+}
+
+// TestReadIPsFromStdinPipe -path=- 从管道读取，读取、处理和去重同时进行，重复的目标只送出一次
+func TestReadIPsFromStdinPipe(t *testing.T) {
+	withPipelineFlags(t)
+	*dedupMem = 1 // 约 1 万条后切换为布隆过滤器
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdin = r
+	const unique = 12000
+	go func() {
+		defer w.Close()
+		for round := 0; round < 2; round++ {
+			for i := 0; i < unique; i++ {
+				fmt.Fprintf(w, "104.%d.%d.%d 443\n", 16+i>>16, i>>8&0xff, i&0xff)
+			}
+		}
+		fmt.Fprintln(w, "10.0.0.1 443")
+		fmt.Fprintln(w, "::ffff:104.16.0.0 443")
+	}()
+
+	targets, total, err := runReadIPs(t, "-")
+	r.Close()
+	if err != nil {
+		t.Fatalf("readIPs() error = %v", err)
+	}
+	if total != unique || len(targets) != unique {
+		t.Errorf("readIPs() sent %d targets, returned %d, want %d", len(targets), total, unique)
+	}
+	seen := make(map[string]bool)
+	for _, target := range targets {
+		if seen[target.Key()] || target.Source != "-" {
+			t.Errorf("target %s repeated or has source %q", target, target.Source)
+		}
+		seen[target.Key()] = true
+	}
+	if sourceTargetCounts["-"] != unique {
+		t.Errorf("sourceTargetCounts[-] = %d", sourceTargetCounts["-"])
+	}
+}
+
+func TestReadIPsPortsAndExclude(t *testing.T) {
+	withPipelineFlags(t)
+	dir := t.TempDir()
+	path := dir + "/ip.txt"
+	excludePath := dir + "/exclude.txt"
+	content := strings.Join([]string{"1.1.1.1 80", "1.1.1.1:443", "8.8.8.8", "192.168.1.1", "2606:4700::1 2053"}, "\n")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(excludePath, []byte("8.8.8.0/24\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	*testPorts, *ports, *exclude = "443,2053", "443,2053", excludePath
+
+	targets, total, err := runReadIPs(t, path)
+	var got []string
+	for _, target := range targets {
+		got = append(got, target.String())
+	}
+	want := []string{"1.1.1.1:443", "1.1.1.1:2053", "[2606:4700::1]:443", "[2606:4700::1]:2053"}
+	if err != nil || total != len(want) || !slices.Equal(got, want) {
+		t.Errorf("readIPs() = %v, %d, %v, want %v", got, total, err, want)
+	}
+}
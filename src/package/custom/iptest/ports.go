@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Cloudflare 支持的 HTTP/HTTPS 端口，可在端口列表中用 http、https 代替
+var (
+	cfHTTPSPorts = []int{443, 2053, 2083, 2087, 2096, 8443}
+	cfHTTPPorts  = []int{80, 8080, 8880, 2052, 2082, 2086, 2095}
+)
+
+// parsePortSpec 解析端口列表，支持 "443,2053,8443"、"2052-2096" 及其组合，
+// 以及 https/http 代表 Cloudflare 的全部 HTTPS/HTTP 端口，结果去重并保持原有顺序
+func parsePortSpec(spec string) ([]int, error) {
+	var ports []int
+	seen := make(map[int]bool)
+	add := func(p int) {
+		if !seen[p] {
+			seen[p] = true
+			ports = append(ports, p)
+		}
+	}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		switch strings.ToLower(item) {
+		case "":
+			continue
+		case "https":
+			for _, p := range cfHTTPSPorts {
+				add(p)
+			}
+			continue
+		case "http":
+			for _, p := range cfHTTPPorts {
+				add(p)
+			}
+			continue
+		}
+		if lo, hi, ok := strings.Cut(item, "-"); ok {
+			start, err1 := parsePort(lo)
+			end, err2 := parsePort(hi)
+			if err1 != nil || err2 != nil || end < start {
+				return nil, fmt.Errorf("端口范围无效: %s", item)
+			}
+			for p := start; p <= end; p++ {
+				add(p)
+			}
+			continue
+		}
+		p, err := parsePort(item)
+		if err != nil {
+			return nil, err
+		}
+		add(p)
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("端口列表为空: %s", spec)
+	}
+	return ports, nil
+}
+
+// parsePort 解析单个端口，要求在 1-65535 之间
+func parsePort(s string) (int, error) {
+	p, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || p <= 0 || p >= 65536 {
+		return 0, fmt.Errorf("端口无效: %s", s)
+	}
+	return p, nil
+}
+
+// formatPorts 将端口列表格式化为逗号分隔的字符串
+func formatPorts(ports []int) string {
+	sorted := append([]int(nil), ports...)
+	sort.Ints(sorted)
+	strs := make([]string, len(sorted))
+	for i, p := range sorted {
+		strs[i] = strconv.Itoa(p)
+	}
+	return strings.Join(strs, ",")
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePortSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []int
+		wantErr bool
+	}{
+		{"443", []int{443}, false},
+		{"443,2053,8443", []int{443, 2053, 8443}, false},
+		{" 443 , 8443 ", []int{443, 8443}, false},
+		{"2052-2054", []int{2052, 2053, 2054}, false},
+		{"8443,443-444,443", []int{8443, 443, 444}, false},
+		{"https", cfHTTPSPorts, false},
+		{"HTTP", cfHTTPPorts, false},
+		{"https,443,80", append(append([]int(nil), cfHTTPSPorts...), 80), false},
+		{"1,65535", []int{1, 65535}, false},
+		{"", nil, true},
+		{",", nil, true},
+		{"0", nil, true},
+		{"65536", nil, true},
+		{"443-80", nil, true},
+		{"80-", nil, true},
+		{"tls", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parsePortSpec(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePortSpec(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("parsePortSpec(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParsePortListLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		host  string
+		ports []int
+		ok    bool
+	}{
+		{"1.1.1.1 443,8443", "1.1.1.1", []int{443, 8443}, true},
+		{"1.1.1.1 2052-2054 # 标签", "1.1.1.1", []int{2052, 2053, 2054}, true},
+		{"1.1.1.1:443,8443", "1.1.1.1", []int{443, 8443}, true},
+		{"[2606:4700::1]:443-444", "2606:4700::1", []int{443, 444}, true},
+		{"2606:4700::1 443, 8443", "2606:4700::1", []int{443, 8443}, true},
+		{"example.com 443,2053", "example.com", []int{443, 2053}, true},
+		{"1.1.1.1 443-80", "1.1.1.1", nil, true},
+		{"1.1.1.1 443", "", nil, false},
+		{"1.1.1.1:443", "", nil, false},
+	}
+	for _, tt := range tests {
+		host, ports, ok := parsePortListLine(tt.line)
+		if host != tt.host || !slices.Equal(ports, tt.ports) || ok != tt.ok {
+			t.Errorf("parsePortListLine(%q) = %q, %v, %v, want %q, %v, %v", tt.line, host, ports, ok, tt.host, tt.ports, tt.ok)
+		}
+	}
+}
+
+func TestFormatPorts(t *testing.T) {
+	if got := formatPorts([]int{8443, 443, 2053}); got != "443,2053,8443" {
+		t.Errorf("formatPorts() = %q", got)
+	}
+}
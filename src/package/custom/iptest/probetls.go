@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// certPins -pin 指定的证书 SHA-256 指纹，为空时按常规方式校验证书
+var certPins [][sha256.Size]byte
+
+// parseCertPins 解析 -pin：逗号分隔的证书 SHA-256 指纹，可以是十六进制（可带冒号，
+// 即 openssl x509 -noout -fingerprint -sha256 的输出）或 base64
+func parseCertPins(spec string) ([][sha256.Size]byte, error) {
+	var pins [][sha256.Size]byte
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		// sha256 Fingerprint=AB:CD:...，base64 末尾的 = 不是分隔符
+		if i := strings.Index(strings.ToLower(item), "fingerprint="); i != -1 {
+			item = item[i+len("fingerprint="):]
+		}
+		for _, prefix := range []string{"sha256:", "sha256/"} {
+			if len(item) > len(prefix) && strings.EqualFold(item[:len(prefix)], prefix) {
+				item = item[len(prefix):]
+			}
+		}
+		b, err := hex.DecodeString(strings.ReplaceAll(item, ":", ""))
+		if err != nil || len(b) != sha256.Size {
+			b, err = base64.StdEncoding.DecodeString(item)
+			if err != nil {
+				b, err = base64.RawStdEncoding.DecodeString(item)
+			}
+		}
+		if err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("证书指纹无效: %s，应为64位十六进制或44位base64的SHA-256指纹", item)
+		}
+		var pin [sha256.Size]byte
+		copy(pin[:], b)
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
+
+// probeHost 返回探测请求的 Host：-host、分享链接中的 host、分享链接中的 SNI，最后是 -tcpurl
+func probeHost(target Target) string {
+	return firstNonEmpty(*hostHeader, target.meta("host"), target.SNI, *TCPurl)
+}
+
+// probeSNI 返回 TLS 握手使用的 SNI：-sni、目标自身的 SNI（来自分享链接），否则与 Host 相同
+func probeSNI(target Target, host string) string {
+	if sni := firstNonEmpty(*sniFlag, target.SNI); sni != "" {
+		return sni
+	}
+	host, _, _ = strings.Cut(host, "/")
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host
+}
+
+// probeTLSConfig 返回探测使用的 TLS 配置。-insecure 时不校验证书；指定 -pin 时只要求证书指纹匹配，
+// 不再校验证书链和域名，适合测试证书与 SNI 不一致或自签证书的主机
+func probeTLSConfig(sni string) *tls.Config {
+	config := &tls.Config{
+		ServerName:         sni,
+		InsecureSkipVerify: *insecureTLS || len(certPins) > 0,
+	}
+	if len(certPins) > 0 {
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("服务器未提供证书")
+			}
+			sum := sha256.Sum256(rawCerts[0])
+			for _, pin := range certPins {
+				if bytes.Equal(sum[:], pin[:]) {
+					return nil
+				}
+			}
+			return fmt.Errorf("证书指纹 %x 不匹配", sum)
+		}
+	}
+	return config
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseCertPins(t *testing.T) {
+	sum := sha256.Sum256([]byte("iptest"))
+	hexPin := hex.EncodeToString(sum[:])
+	var colonPin []string
+	for i := 0; i < len(hexPin); i += 2 {
+		colonPin = append(colonPin, strings.ToUpper(hexPin[i:i+2]))
+	}
+	b64Pin := base64.StdEncoding.EncodeToString(sum[:])
+
+	tests := []struct {
+		spec    string
+		want    int
+		wantErr bool
+	}{
+		{spec: "", want: 0},
+		{spec: hexPin, want: 1},
+		{spec: "sha256 Fingerprint=" + strings.Join(colonPin, ":"), want: 1},
+		{spec: "SHA256:" + hexPin, want: 1},
+		{spec: b64Pin, want: 1},
+		{spec: "sha256/" + b64Pin, want: 1},
+		{spec: strings.TrimRight(b64Pin, "="), want: 1},
+		{spec: hexPin + ", " + b64Pin + ",", want: 2},
+		{spec: hexPin[:62], wantErr: true},
+		{spec: hexPin + "00", wantErr: true},
+		{spec: base64.StdEncoding.EncodeToString(sum[:31]), wantErr: true},
+		{spec: "not-a-pin", wantErr: true},
+		{spec: hexPin + ",zz", wantErr: true},
+	}
+	for _, tt := range tests {
+		pins, err := parseCertPins(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCertPins(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if len(pins) != tt.want {
+			t.Errorf("parseCertPins(%q) = %d pins, want %d", tt.spec, len(pins), tt.want)
+		}
+		for _, pin := range pins {
+			if pin != sum {
+				t.Errorf("parseCertPins(%q) = %x, want %x", tt.spec, pin, sum)
+			}
+		}
+	}
+}
+
+// TestProbeTLSConfigPins 对自签证书的 httptest 服务器分别测试匹配、不匹配和未指定指纹的情况
+func TestProbeTLSConfigPins(t *testing.T) {
+	server := httptest.NewTLSServer(nil)
+	defer server.Close()
+	pins, insecure := certPins, *insecureTLS
+	t.Cleanup(func() { certPins, *insecureTLS = pins, insecure })
+	*insecureTLS = false
+
+	sum := sha256.Sum256(server.Certificate().Raw)
+	other := sha256.Sum256([]byte("other"))
+	handshake := func(sni string) error {
+		conn, err := tls.Dial("tcp", server.Listener.Addr().String(), probeTLSConfig(sni))
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+
+	// SNI 与证书不一致，只要指纹匹配即可
+	certPins = [][sha256.Size]byte{other, sum}
+	if err := handshake("cdn.example.com"); err != nil {
+		t.Errorf("handshake with a matching pin: %v", err)
+	}
+	certPins = [][sha256.Size]byte{other}
+	if err := handshake("example.com"); err == nil || !strings.Contains(err.Error(), "不匹配") {
+		t.Errorf("handshake with a mismatched pin: %v", err)
+	}
+	certPins = nil
+	if err := handshake("example.com"); err == nil {
+		t.Error("self-signed certificate accepted without -pin or -insecure")
+	}
+	*insecureTLS = true
+	if err := handshake("example.com"); err != nil {
+		t.Errorf("handshake with -insecure: %v", err)
+	}
+}
+
+func TestProbeHostAndSNI(t *testing.T) {
+	host, sni, tcpURL := *hostHeader, *sniFlag, *TCPurl
+	t.Cleanup(func() { *hostHeader, *sniFlag, *TCPurl = host, sni, tcpURL })
+
+	shared, err := newTarget("104.16.1.2", 443)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared.SNI = "sni.example.com"
+	shared.setMeta("host", "host.example.com")
+	sniOnly, _ := newTarget("104.16.1.2", 443)
+	sniOnly.SNI = "sni.example.com"
+	plain, _ := newTarget("104.16.1.2", 443)
+
+	tests := []struct {
+		name              string
+		hostFlag, sniFlag string
+		target            Target
+		wantHost, wantSNI string
+	}{
+		{name: "flags", hostFlag: "flag.example.com", sniFlag: "flagsni.example.com", target: shared, wantHost: "flag.example.com", wantSNI: "flagsni.example.com"},
+		{name: "host flag", hostFlag: "flag.example.com", target: plain, wantHost: "flag.example.com", wantSNI: "flag.example.com"},
+		{name: "share link", target: shared, wantHost: "host.example.com", wantSNI: "sni.example.com"},
+		{name: "share link sni", target: sniOnly, wantHost: "sni.example.com", wantSNI: "sni.example.com"},
+		{name: "sni flag", sniFlag: "flagsni.example.com", target: sniOnly, wantHost: "sni.example.com", wantSNI: "flagsni.example.com"},
+		{name: "tcpurl", target: plain, wantHost: "speed.example.com:8443/path", wantSNI: "speed.example.com"},
+	}
+	*TCPurl = "speed.example.com:8443/path"
+	for _, tt := range tests {
+		*hostHeader, *sniFlag = tt.hostFlag, tt.sniFlag
+		gotHost := probeHost(tt.target)
+		if gotSNI := probeSNI(tt.target, gotHost); gotHost != tt.wantHost || gotSNI != tt.wantSNI {
+			t.Errorf("%s: host %q, sni %q, want %q, %q", tt.name, gotHost, gotSNI, tt.wantHost, tt.wantSNI)
+		}
+	}
+}
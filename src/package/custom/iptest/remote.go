@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// remoteCacheMeta 记录远程源的缓存信息，用于条件请求
+type remoteCacheMeta struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag"`
+	LastModified string    `json:"last_modified"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// isRemoteSource 判断来源是否为 http/https 地址
+func isRemoteSource(source string) bool {
+	lower := strings.ToLower(source)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// remoteCachePath 返回远程源在缓存目录中的文件路径，保留原扩展名以便按格式解析
+func remoteCachePath(rawURL string) string {
+	sum := sha1.Sum([]byte(rawURL))
+	name := hex.EncodeToString(sum[:])
+	if u, err := url.Parse(rawURL); err == nil {
+		if ext := path.Ext(u.Path); len(ext) <= 8 {
+			name += ext
+		}
+	}
+	return filepath.Join(*cacheDir, name)
+}
+
+// offlineMode 为 true 时不访问网络，远程源只使用本地缓存（parse 子命令）
+var offlineMode bool
+
+// fetchRemoteSource 下载远程源到缓存目录并返回本地文件路径。
+// 使用 ETag/Last-Modified 条件请求，未变化时直接使用缓存；下载失败时回退到上次缓存
+func fetchRemoteSource(rawURL string) (string, error) {
+	cachePath := remoteCachePath(rawURL)
+	metaPath := cachePath + ".meta"
+
+	var meta remoteCacheMeta
+	_, statErr := os.Stat(cachePath)
+	hasCache := statErr == nil
+	if hasCache {
+		if data, err := os.ReadFile(metaPath); err == nil {
+			json.Unmarshal(data, &meta)
+		}
+	}
+
+	if offlineMode {
+		if !hasCache {
+			return "", fmt.Errorf("离线模式下没有本地缓存")
+		}
+		fmt.Printf("离线模式，使用 %s 的缓存 (%s)\n", rawURL, meta.FetchedAt.Format("2006/01/02 15:04:05"))
+		return cachePath, nil
+	}
+
+	err := downloadRemoteSource(rawURL, cachePath, metaPath, hasCache, meta)
+	if err == nil {
+		return cachePath, nil
+	}
+	if hasCache {
+		fmt.Printf("下载 %s 失败: %v，使用上次缓存 (%s)\n", rawURL, err, meta.FetchedAt.Format("2006/01/02 15:04:05"))
+		return cachePath, nil
+	}
+	return "", err
+}
+
+// downloadRemoteSource 执行实际的下载，写入临时文件后原子替换缓存
+func downloadRemoteSource(rawURL, cachePath, metaPath string, hasCache bool, meta remoteCacheMeta) error {
+	if err := os.MkdirAll(*cacheDir, 0755); err != nil {
+		return fmt.Errorf("创建缓存目录失败: %w", err)
+	}
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	if hasCache {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	client := &http.Client{Timeout: *fetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && hasCache {
+		fmt.Printf("远程源 %s 未变化，使用缓存\n", rawURL)
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP状态码 %d", resp.StatusCode)
+	}
+
+	maxBytes := *fetchMaxMB << 20
+	tmp, err := os.CreateTemp(*cacheDir, ".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	tmp.Chmod(0644)
+	written, err := io.Copy(tmp, io.LimitReader(resp.Body, maxBytes+1))
+	tmp.Close()
+	if err != nil {
+		return fmt.Errorf("下载中断: %w", err)
+	}
+	if written > maxBytes {
+		return fmt.Errorf("文件超过大小限制 %d MB (可通过 -fetchmax 调整)", *fetchMaxMB)
+	}
+	if written == 0 {
+		return fmt.Errorf("下载内容为空")
+	}
+	if err := os.Rename(tmp.Name(), cachePath); err != nil {
+		return err
+	}
+
+	meta = remoteCacheMeta{
+		URL:          rawURL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+	}
+	if data, err := json.Marshal(meta); err == nil {
+		os.WriteFile(metaPath, data, 0644)
+	}
+	fmt.Printf("已下载远程源 %s (%d 字节)\n", rawURL, written)
+	return nil
+}
+
+// readRemoteSource 下载并解析远程源，返回解析出的目标数量
+func readRemoteSource(rawURL string, emit func(Target)) (int, error) {
+	localPath, err := fetchRemoteSource(rawURL)
+	if err != nil {
+		return 0, fmt.Errorf("下载 %s 失败: %w", rawURL, err)
+	}
+	// 来源记录为远程地址而不是缓存文件路径
+	count, err := readIPsFromFile(localPath, func(t Target) {
+		t.Source = rawURL
+		emit(t)
+	})
+	if err != nil {
+		return count, fmt.Errorf("读取 %s 时出错: %w", rawURL, err)
+	}
+	fmt.Printf("正在读取远程源: %s 解析到 %d 条\n", rawURL, count)
+	return count, nil
+}
+
+// readURLList 读取 .url 文件中列出的远程源（每行一个地址），逐个下载解析
+func readURLList(listPath string, emit func(Target)) (int, error) {
+	file, err := os.Open(listPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	total := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !isRemoteSource(line) {
+			fmt.Printf("跳过无效远程源(仅支持http/https): %s\n", line)
+			continue
+		}
+		count, err := readRemoteSource(line, emit)
+		total += count
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+	return total, scanner.Err()
+}
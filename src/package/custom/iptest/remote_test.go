@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// withRemoteFlags 使用临时缓存目录，测试结束后恢复下载相关参数
+func withRemoteFlags(t *testing.T) {
+	t.Helper()
+	dir, timeout, maxMB, offline := *cacheDir, *fetchTimeout, *fetchMaxMB, offlineMode
+	t.Cleanup(func() { *cacheDir, *fetchTimeout, *fetchMaxMB, offlineMode = dir, timeout, maxMB, offline })
+	*cacheDir, *fetchTimeout, *fetchMaxMB, offlineMode = t.TempDir(), 5*time.Second, 1, false
+}
+
+// remoteStub 可在测试中修改响应的远程源服务器，记录每次请求的条件请求头
+type remoteStub struct {
+	mu           sync.Mutex
+	status       int
+	etag, body   string
+	ifNoneMatch  []string
+	lastModified string
+}
+
+func (s *remoteStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ifNoneMatch = append(s.ifNoneMatch, r.Header.Get("If-None-Match"))
+	switch {
+	case s.status != http.StatusOK:
+		http.Error(w, "error", s.status)
+	case s.etag != "" && r.Header.Get("If-None-Match") == s.etag:
+		w.WriteHeader(http.StatusNotModified)
+	default:
+		w.Header().Set("ETag", s.etag)
+		if s.lastModified != "" {
+			w.Header().Set("Last-Modified", s.lastModified)
+		}
+		w.Write([]byte(s.body))
+	}
+}
+
+func (s *remoteStub) set(status int, etag, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status, s.etag, s.body = status, etag, body
+}
+
+func readCache(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFetchRemoteSourceConditional(t *testing.T) {
+	withRemoteFlags(t)
+	stub := &remoteStub{lastModified: "Mon, 02 Jan 2006 15:04:05 GMT"}
+	stub.set(http.StatusOK, `"v1"`, "1.1.1.1 443\n")
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	rawURL := server.URL + "/ip.txt"
+
+	path, err := fetchRemoteSource(rawURL)
+	if err != nil || path != remoteCachePath(rawURL) || !strings.HasSuffix(path, ".txt") {
+		t.Fatalf("fetchRemoteSource() = %s, %v", path, err)
+	}
+	var meta remoteCacheMeta
+	data, _ := os.ReadFile(path + ".meta")
+	if err := json.Unmarshal(data, &meta); err != nil || meta.ETag != `"v1"` || meta.URL != rawURL || meta.LastModified != stub.lastModified {
+		t.Errorf("cache meta = %+v, %v", meta, err)
+	}
+
+	// 未变化时服务器返回 304，缓存保持不变
+	if path, err = fetchRemoteSource(rawURL); err != nil || readCache(t, path) != "1.1.1.1 443\n" {
+		t.Errorf("fetch after 304 = %s, %v", path, err)
+	}
+	// 内容变化后更新缓存和 ETag
+	stub.set(http.StatusOK, `"v2"`, "1.0.0.1 443\n")
+	if path, err = fetchRemoteSource(rawURL); err != nil || readCache(t, path) != "1.0.0.1 443\n" {
+		t.Errorf("fetch after change = %s, %v", path, err)
+	}
+	data, _ = os.ReadFile(path + ".meta")
+	if json.Unmarshal(data, &meta); meta.ETag != `"v2"` {
+		t.Errorf("cache meta ETag = %s, want \"v2\"", meta.ETag)
+	}
+	if want := []string{"", `"v1"`, `"v1"`}; !slices.Equal(stub.ifNoneMatch, want) {
+		t.Errorf("If-None-Match = %q, want %q", stub.ifNoneMatch, want)
+	}
+}
+
+func TestFetchRemoteSourceFallback(t *testing.T) {
+	withRemoteFlags(t)
+	stub := &remoteStub{}
+	stub.set(http.StatusInternalServerError, "", "")
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	rawURL := server.URL + "/nodes.yaml"
+
+	// 没有缓存时下载失败返回错误
+	if _, err := fetchRemoteSource(rawURL); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("fetch without cache: %v", err)
+	}
+	stub.set(http.StatusOK, "", "proxies: []\n")
+	if _, err := fetchRemoteSource(rawURL); err != nil {
+		t.Fatal(err)
+	}
+	// 服务器出错或不可达时使用上次缓存
+	stub.set(http.StatusBadGateway, "", "")
+	if path, err := fetchRemoteSource(rawURL); err != nil || readCache(t, path) != "proxies: []\n" {
+		t.Errorf("fetch on 502 = %s, %v, want the cached copy", path, err)
+	}
+	server.Close()
+	if path, err := fetchRemoteSource(rawURL); err != nil || readCache(t, path) != "proxies: []\n" {
+		t.Errorf("fetch with the server down = %s, %v, want the cached copy", path, err)
+	}
+	// 离线模式只使用缓存
+	offlineMode = true
+	if path, err := fetchRemoteSource(rawURL); err != nil || path != remoteCachePath(rawURL) {
+		t.Errorf("offline fetch = %s, %v", path, err)
+	}
+	if _, err := fetchRemoteSource(server.URL + "/other.txt"); err == nil {
+		t.Error("offline fetch without cache succeeded")
+	}
+}
+
+func TestFetchRemoteSourceMaxSize(t *testing.T) {
+	withRemoteFlags(t)
+	stub := &remoteStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	// -fetchmax 1 允许正好 1 MB，超出则放弃且不留下缓存和临时文件
+	stub.set(http.StatusOK, "", strings.Repeat("a", 1<<20))
+	if _, err := fetchRemoteSource(server.URL + "/exact.txt"); err != nil {
+		t.Errorf("fetch of exactly -fetchmax bytes: %v", err)
+	}
+	stub.set(http.StatusOK, "", strings.Repeat("a", 1<<20+1))
+	rawURL := server.URL + "/big.txt"
+	if _, err := fetchRemoteSource(rawURL); err == nil || !strings.Contains(err.Error(), "-fetchmax") {
+		t.Errorf("fetch over -fetchmax: %v", err)
+	}
+	if _, err := os.Stat(remoteCachePath(rawURL)); !os.IsNotExist(err) {
+		t.Errorf("oversized download left a cache file: %v", err)
+	}
+	entries, _ := os.ReadDir(*cacheDir)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".download-") {
+			t.Errorf("temporary file %s left behind", entry.Name())
+		}
+	}
+	stub.set(http.StatusOK, "", "")
+	if _, err := fetchRemoteSource(server.URL + "/empty.txt"); err == nil {
+		t.Error("empty download accepted")
+	}
+}
+
+func TestReadRemoteSource(t *testing.T) {
+	withRemoteFlags(t)
+	stub := &remoteStub{}
+	stub.set(http.StatusOK, "", "1.1.1.1 443\n1.0.0.1:2053\n")
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	rawURL := server.URL + "/ip.txt"
+
+	var got []string
+	count, err := readRemoteSource(rawURL, func(target Target) {
+		got = append(got, target.Key()+" "+target.Source)
+	})
+	want := []string{"1.1.1.1:443 " + rawURL, "1.0.0.1:2053 " + rawURL}
+	if err != nil || count != 2 || !slices.Equal(got, want) {
+		t.Errorf("readRemoteSource() = %v, %d, %v, want %v", got, count, err, want)
+	}
+}
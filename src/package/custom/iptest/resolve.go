@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	dnsTimeout     = 5 * time.Second // 单次域名解析超时时间
+	dnsConcurrency = 16              // 并发解析的域名数量
+)
+
+// dnsMismatchDomains 记录多个解析器结果不一致的域名，用于报告
+var (
+	dnsMismatchDomains []string
+	dnsMismatchMutex   sync.Mutex
+)
+
+// dnsResolver 表示一个可用于解析域名的解析器
+type dnsResolver struct {
+	name   string
+	lookup func(ctx context.Context, host string) ([]netip.Addr, error)
+}
+
+// newDNSResolvers 根据 -resolver 参数创建解析器列表，多个解析器用逗号分隔：
+// system 使用系统解析器，8.8.8.8 / udp://8.8.8.8:53 / tcp://8.8.8.8:53 使用指定DNS服务器，
+// https://1.1.1.1/dns-query 使用DoH，none 表示不解析
+func newDNSResolvers(spec string) ([]dnsResolver, error) {
+	var resolvers []dnsResolver
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		switch {
+		case item == "":
+			continue
+		case item == "none":
+			return nil, nil
+		case item == "system":
+			resolvers = append(resolvers, dnsResolver{
+				name: "system",
+				lookup: func(ctx context.Context, host string) ([]netip.Addr, error) {
+					return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+				},
+			})
+		case strings.HasPrefix(item, "https://"):
+			endpoint := item
+			resolvers = append(resolvers, dnsResolver{
+				name: endpoint,
+				lookup: func(ctx context.Context, host string) ([]netip.Addr, error) {
+					return lookupDoH(ctx, endpoint, host)
+				},
+			})
+		default:
+			network, server := "udp", item
+			if u, err := url.Parse(item); err == nil && (u.Scheme == "udp" || u.Scheme == "tcp") {
+				network, server = u.Scheme, u.Host
+			}
+			if _, _, err := net.SplitHostPort(server); err != nil {
+				server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+			}
+			if _, err := netip.ParseAddrPort(server); err != nil {
+				return nil, fmt.Errorf("无效的DNS服务器: %s", item)
+			}
+			resolver := &net.Resolver{
+				PreferGo: true,
+				Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, network, server)
+				},
+			}
+			resolvers = append(resolvers, dnsResolver{
+				name: item,
+				lookup: func(ctx context.Context, host string) ([]netip.Addr, error) {
+					return resolver.LookupNetIP(ctx, "ip", host)
+				},
+			})
+		}
+	}
+	if len(resolvers) == 0 {
+		return nil, fmt.Errorf("未指定解析器")
+	}
+	return resolvers, nil
+}
+
+// lookupDoH 通过 DNS over HTTPS (RFC 8484) 查询域名的 A 和 AAAA 记录
+func lookupDoH(ctx context.Context, endpoint, host string) ([]netip.Addr, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return nil, err
+	}
+	var addrs []netip.Addr
+	var lastErr error
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		msg := dnsmessage.Message{
+			Header:    dnsmessage.Header{RecursionDesired: true},
+			Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+		}
+		packed, err := msg.Pack()
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(packed))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/dns-message")
+		req.Header.Set("Accept", "application/dns-message")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("DoH服务器返回状态码 %d", resp.StatusCode)
+			continue
+		}
+		var answer dnsmessage.Message
+		if err := answer.Unpack(body); err != nil {
+			lastErr = fmt.Errorf("解析DoH响应失败: %v", err)
+			continue
+		}
+		for _, rr := range answer.Answers {
+			switch r := rr.Body.(type) {
+			case *dnsmessage.AResource:
+				addrs = append(addrs, netip.AddrFrom4(r.A))
+			case *dnsmessage.AAAAResource:
+				addrs = append(addrs, netip.AddrFrom16(r.AAAA))
+			}
+		}
+	}
+	if len(addrs) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return addrs, nil
+}
+
+// resolveDomain 使用所有解析器解析域名，返回去重后的并集；多个解析器结果不一致时打印对比
+func resolveDomain(resolvers []dnsResolver, domain string) ([]netip.Addr, error) {
+	var union []netip.Addr
+	seen := make(map[netip.Addr]bool)
+	answers := make([]string, len(resolvers))
+	var lastErr error
+	for i, resolver := range resolvers {
+		ctx, cancel := context.WithTimeout(context.Background(), dnsTimeout)
+		addrs, err := resolver.lookup(ctx, domain)
+		cancel()
+		if err != nil {
+			lastErr = err
+			answers[i] = "解析失败: " + err.Error()
+			continue
+		}
+		strs := make([]string, 0, len(addrs))
+		for _, addr := range addrs {
+			addr = addr.Unmap()
+			strs = append(strs, addr.String())
+			if !seen[addr] {
+				seen[addr] = true
+				union = append(union, addr)
+			}
+		}
+		sort.Strings(strs)
+		answers[i] = strings.Join(strs, ", ")
+	}
+
+	if len(resolvers) > 1 {
+		// 全部解析失败时不做对比，仅有部分解析器失败也视为不一致
+		consistent := true
+		for _, a := range answers[1:] {
+			if a != answers[0] {
+				consistent = false
+				break
+			}
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "域名解析对比 %s:\n", domain)
+		for i, resolver := range resolvers {
+			fmt.Fprintf(&b, "  %s: %s\n", resolver.name, answers[i])
+		}
+		if len(union) == 0 {
+			consistent = true
+		}
+		if !consistent {
+			fmt.Fprintf(&b, "  ⚠️ 各解析器结果不一致，可能存在DNS污染或按地区调度\n")
+		}
+		fmt.Print(b.String())
+		if !consistent {
+			dnsMismatchMutex.Lock()
+			dnsMismatchDomains = append(dnsMismatchDomains, domain)
+			dnsMismatchMutex.Unlock()
+		}
+	}
+
+	if len(union) == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("无解析记录")
+		}
+		return nil, lastErr
+	}
+	return union, nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsTestRecords 测试用 DNS 服务器的记录
+var dnsTestRecords = map[string][]netip.Addr{
+	"cdn.example.com.": {netip.MustParseAddr("104.16.1.2"), netip.MustParseAddr("104.16.1.3"), netip.MustParseAddr("2606:4700::1")},
+	"v4.example.com.":  {netip.MustParseAddr("104.16.2.2")},
+}
+
+// dnsTestAnswer 按 dnsTestRecords 回答查询，A 和 AAAA 只返回对应族的地址
+func dnsTestAnswer(t *testing.T, query []byte) []byte {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil || len(msg.Questions) != 1 {
+		t.Errorf("bad DNS query: %v", err)
+		return nil
+	}
+	q := msg.Questions[0]
+	msg.Header.Response, msg.Header.RecursionAvailable = true, true
+	records, ok := dnsTestRecords[strings.ToLower(q.Name.String())]
+	if !ok {
+		msg.Header.RCode = dnsmessage.RCodeNameError
+	}
+	for _, addr := range records {
+		header := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: 60}
+		switch {
+		case q.Type == dnsmessage.TypeA && addr.Is4():
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: addr.As4()}})
+		case q.Type == dnsmessage.TypeAAAA && addr.Is6():
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AAAAResource{AAAA: addr.As16()}})
+		}
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		t.Errorf("pack DNS answer: %v", err)
+	}
+	return packed
+}
+
+// stubDoHServer 返回一个按 RFC 8484 POST 方式应答的 DoH 服务器，并统计查询次数；
+// 测试期间 http.DefaultClient 信任该服务器的自签证书
+func stubDoHServer(t *testing.T) (string, *atomic.Int32) {
+	var queries atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(dnsTestAnswer(t, body))
+	}))
+	t.Cleanup(server.Close)
+	client := http.DefaultClient
+	http.DefaultClient = server.Client()
+	t.Cleanup(func() { http.DefaultClient = client })
+	return server.URL + "/dns-query", &queries
+}
+
+// stubUDPDNSServer 在本地 UDP 端口上应答 DNS 查询
+func stubUDPDNSServer(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(dnsTestAnswer(t, buf[:n]), addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func lookupStrings(t *testing.T, resolver dnsResolver, host string) ([]string, error) {
+	t.Helper()
+	addrs, err := resolver.lookup(context.Background(), host)
+	var got []string
+	for _, addr := range addrs {
+		got = append(got, addr.Unmap().String())
+	}
+	slices.Sort(got)
+	return got, err
+}
+
+func TestNewDNSResolvers(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{spec: "none", want: nil},
+		{spec: "system", want: []string{"system"}},
+		{spec: " 8.8.8.8 , system", want: []string{"8.8.8.8", "system"}},
+		{spec: "udp://1.1.1.1:5353,tcp://[2606:4700:4700::1111]", want: []string{"udp://1.1.1.1:5353", "tcp://[2606:4700:4700::1111]"}},
+		{spec: "2001:4860:4860::8888,[::1]:53", want: []string{"2001:4860:4860::8888", "[::1]:53"}},
+		{spec: "https://1.1.1.1/dns-query", want: []string{"https://1.1.1.1/dns-query"}},
+		{spec: "system,none", want: nil},
+		{spec: "", wantErr: true},
+		{spec: " , ", wantErr: true},
+		{spec: "dns.google", wantErr: true},
+		{spec: "system,8.8.8.8:abc", wantErr: true},
+		{spec: "quic://1.1.1.1", wantErr: true},
+	}
+	for _, tt := range tests {
+		resolvers, err := newDNSResolvers(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newDNSResolvers(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		var names []string
+		for _, r := range resolvers {
+			names = append(names, r.name)
+		}
+		if !slices.Equal(names, tt.want) {
+			t.Errorf("newDNSResolvers(%q) = %v, want %v", tt.spec, names, tt.want)
+		}
+	}
+}
+
+// TestResolversFanOut DoH 和 UDP 解析器都分别查询 A 和 AAAA 并合并结果
+func TestResolversFanOut(t *testing.T) {
+	endpoint, queries := stubDoHServer(t)
+	udpServer := stubUDPDNSServer(t)
+	resolvers, err := newDNSResolvers(endpoint + ",udp://" + udpServer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"104.16.1.2", "104.16.1.3", "2606:4700::1"}
+	for _, resolver := range resolvers {
+		got, err := lookupStrings(t, resolver, "CDN.example.com")
+		if err != nil || !slices.Equal(got, want) {
+			t.Errorf("%s: lookup = %v, %v, want %v", resolver.name, got, err, want)
+		}
+		got, err = lookupStrings(t, resolver, "v4.example.com.")
+		if err != nil || !slices.Equal(got, []string{"104.16.2.2"}) {
+			t.Errorf("%s: lookup v4 = %v, %v", resolver.name, got, err)
+		}
+	}
+	if queries.Load() != 4 {
+		t.Errorf("DoH server got %d queries, want A and AAAA for each domain", queries.Load())
+	}
+
+	if got, err := lookupDoH(context.Background(), endpoint, "nx.example.com"); err != nil || len(got) != 0 {
+		t.Errorf("lookupDoH(NXDOMAIN) = %v, %v, want no addresses", got, err)
+	}
+	failing := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	http.DefaultClient = failing.Client()
+	if _, err := lookupDoH(context.Background(), failing.URL, "cdn.example.com"); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("lookupDoH against a failing server: %v", err)
+	}
+}
+
+func TestResolveDomainMismatch(t *testing.T) {
+	saved := dnsMismatchDomains
+	t.Cleanup(func() { dnsMismatchDomains = saved })
+	dnsMismatchDomains = nil
+
+	stub := func(name string, addrs ...string) dnsResolver {
+		return dnsResolver{name: name, lookup: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			if len(addrs) == 0 {
+				return nil, fmt.Errorf("SERVFAIL")
+			}
+			var result []netip.Addr
+			for _, a := range addrs {
+				result = append(result, netip.MustParseAddr(a))
+			}
+			return result, nil
+		}}
+	}
+	tests := []struct {
+		domain    string
+		resolvers []dnsResolver
+		want      []string
+		mismatch  bool
+		wantErr   bool
+	}{
+		// 顺序不同、IPv4 映射地址视为一致
+		{domain: "same.example.com", resolvers: []dnsResolver{stub("a", "104.16.1.2", "104.16.1.3"), stub("b", "::ffff:104.16.1.3", "104.16.1.2")},
+			want: []string{"104.16.1.2", "104.16.1.3"}},
+		{domain: "differ.example.com", resolvers: []dnsResolver{stub("a", "104.16.1.2"), stub("b", "104.16.1.2", "203.0.113.7")},
+			want: []string{"104.16.1.2", "203.0.113.7"}, mismatch: true},
+		{domain: "partial.example.com", resolvers: []dnsResolver{stub("a"), stub("b", "104.16.1.2")},
+			want: []string{"104.16.1.2"}, mismatch: true},
+		{domain: "failed.example.com", resolvers: []dnsResolver{stub("a"), stub("b")}, wantErr: true},
+		{domain: "single.example.com", resolvers: []dnsResolver{stub("a", "2606:4700::1")}, want: []string{"2606:4700::1"}},
+	}
+	var wantMismatch []string
+	for _, tt := range tests {
+		addrs, err := resolveDomain(tt.resolvers, tt.domain)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("resolveDomain(%s) error = %v, wantErr %v", tt.domain, err, tt.wantErr)
+		}
+		var got []string
+		for _, addr := range addrs {
+			got = append(got, addr.String())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("resolveDomain(%s) = %v, want %v", tt.domain, got, tt.want)
+		}
+		if tt.mismatch {
+			wantMismatch = append(wantMismatch, tt.domain)
+		}
+	}
+	if !slices.Equal(dnsMismatchDomains, wantMismatch) {
+		t.Errorf("dnsMismatchDomains = %v, want %v", dnsMismatchDomains, wantMismatch)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// resultLayout 结果 CSV 的列布局，表头和每行记录按同样的条件追加列
+type resultLayout struct {
+	withDomain bool // 有域名解析结果时追加域名列
+	traceCols  []traceColumn
+	searchCols []searchColumn
+}
+
+// newResultLayout 根据结果和 -trace/-searchcols 选择的列创建布局
+func newResultLayout(results []speedtestresult, traceCols []traceColumn, searchCols []searchColumn) resultLayout {
+	layout := resultLayout{traceCols: traceCols, searchCols: searchCols}
+	for _, res := range results {
+		layout.withDomain = layout.withDomain || res.result.target.Hostname != ""
+	}
+	return layout
+}
+
+// header 返回 CSV 表头
+func (l resultLayout) header() []string {
+	header := []string{"IP地址", "端口", "TLS", "数据中心", "地区", "国家代码", "国家", "城市", "网络延迟"}
+	if *speedTest > 0 {
+		header = append(header, "下载速度MB/s")
+	}
+	if *probeCount > 1 {
+		header = append(header, latencyStatsHeader...)
+	}
+	if *showPhases {
+		header = append(header, phaseHeader()...)
+	}
+	if l.withDomain {
+		header = append(header, "域名")
+	}
+	for _, col := range l.traceCols {
+		header = append(header, col.header)
+	}
+	for _, col := range l.searchCols {
+		header = append(header, col.header)
+	}
+	header = append(header, "类型", "来源", "标签")
+	if *retestFile != "" {
+		header = append(header, "上次延迟", "延迟变化")
+		if *speedTest > 0 {
+			header = append(header, "上次下载速度MB/s", "速度变化")
+		}
+		header = append(header, "上次数据中心", "数据中心变化")
+	}
+	return header
+}
+
+// record 返回一条结果对应的 CSV 记录，列与 header 一一对应
+func (l resultLayout) record(res speedtestresult) []string {
+	record := []string{
+		res.result.target.IP(), strconv.Itoa(res.result.target.Port()), strconv.FormatBool(*enableTLS), res.result.dataCenter,
+		res.result.region, res.result.cca1, res.result.cca2, res.result.city, res.result.latency,
+	}
+	if *speedTest > 0 {
+		record = append(record, fmt.Sprintf("%.2f", res.downloadSpeed))
+	}
+	if *probeCount > 1 {
+		record = append(record, res.result.stats.columns()...)
+	}
+	if *showPhases {
+		record = append(record, res.result.phases.columns()...)
+	}
+	if l.withDomain {
+		record = append(record, res.result.target.Hostname)
+	}
+	for _, col := range l.traceCols {
+		record = append(record, col.value(res.result.trace))
+	}
+	for _, col := range l.searchCols {
+		record = append(record, res.result.target.meta(col.key))
+	}
+	record = append(record, kindNames[res.result.kind], res.result.target.Source, res.result.target.Tag)
+	if *retestFile != "" {
+		record = append(record, retestColumns(res, *speedTest > 0)...)
+	}
+	return record
+}
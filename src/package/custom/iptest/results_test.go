@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// withLayoutFlags 关闭测速、多次探测、阶段和对比列，测试结束后恢复
+func withLayoutFlags(t *testing.T) {
+	t.Helper()
+	speed, count, phases, retest := *speedTest, *probeCount, *showPhases, *retestFile
+	t.Cleanup(func() { *speedTest, *probeCount, *showPhases, *retestFile = speed, count, phases, retest })
+	*speedTest, *probeCount, *showPhases, *retestFile = 0, 1, false, ""
+}
+
+// TestResultLayoutSourceAndTag 行尾 #标签、分享链接的节点名和来源一直保留到 CSV 的来源、标签列
+func TestResultLayoutSourceAndTag(t *testing.T) {
+	withPipelineFlags(t)
+	withLayoutFlags(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nodes.txt")
+	content := strings.Join([]string{
+		"1.1.1.1 443 #香港 01",
+		"1.0.0.1:2053 #HK, \"02\"",
+		"104.16.1.2",
+		"vless://uuid@cdn.example.com:8443?security=tls&sni=sni.example.com#节点 03",
+	}, "\n")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	targets, _, err := runReadIPs(t, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var results []speedtestresult
+	for _, target := range targets {
+		results = append(results, speedtestresult{result: result{target: target, dataCenter: "HKG", latency: "12 ms"}})
+	}
+	layout := newResultLayout(results, nil, nil)
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write(layout.header())
+	for _, res := range results {
+		writer.Write(layout.record(res))
+	}
+	writer.Flush()
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := rows[0]
+	col := func(name string) int {
+		i := slices.Index(header, name)
+		if i < 0 {
+			t.Fatalf("header %v has no %s column", header, name)
+		}
+		return i
+	}
+	ip, domain, source, tag := col("IP地址"), col("域名"), col("来源"), col("标签")
+	got := make(map[string][]string)
+	for _, row := range rows[1:] {
+		if len(row) != len(header) {
+			t.Errorf("row %v has %d columns, header has %d", row, len(row), len(header))
+			continue
+		}
+		got[row[ip]] = []string{row[domain], row[source], row[tag]}
+	}
+	want := map[string][]string{
+		"1.1.1.1":         {"", path, "香港 01"},
+		"1.0.0.1":         {"", path, "HK, \"02\""},
+		"104.16.1.2":      {"", path, ""},
+		"cdn.example.com": {"cdn.example.com", path, "节点 03"},
+	}
+	for key, w := range want {
+		if !slices.Equal(got[key], w) {
+			t.Errorf("%s: domain, source, tag = %q, want %q", key, got[key], w)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d rows, want %d", len(got), len(want))
+	}
+
+	// 没有域名时不输出域名列
+	if plain := newResultLayout(results[:1], nil, nil); slices.Contains(plain.header(), "域名") || len(plain.record(results[0])) != len(plain.header()) {
+		t.Errorf("layout without domains: header %v, record %v", plain.header(), plain.record(results[0]))
+	}
+}
+
+// TestSourceMaxAfterDedup -sourcemax 按去重后的目标计数，重复的目标和其他来源已有的目标不占用名额
+func TestSourceMaxAfterDedup(t *testing.T) {
+	withPipelineFlags(t)
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	files := map[string][]string{
+		a: {"1.1.1.1 443", "1.1.1.1:443", "::ffff:1.1.1.1 443", "1.1.1.1 443", "1.1.1.2 443"},
+		b: {"1.1.1.1 443", "2.2.2.1 443", "2.2.2.2 443", "2.2.2.3 443", "2.2.2.4 443"},
+	}
+	for path, lines := range files {
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	*sourceMax = 2
+
+	targets, total, err := runReadIPs(t, a+","+b)
+	if err != nil || total != 4 || len(targets) != 4 {
+		t.Fatalf("readIPs() = %d targets, total %d, %v, want 4", len(targets), total, err)
+	}
+	perSource := make(map[string][]string)
+	for _, target := range targets {
+		perSource[target.Source] = append(perSource[target.Source], target.Key())
+	}
+	slices.Sort(perSource[a])
+	if want := []string{"1.1.1.1:443", "1.1.1.2:443"}; !slices.Equal(perSource[a], want) {
+		t.Errorf("%s sent %v, want %v", a, perSource[a], want)
+	}
+	if len(perSource[b]) != 2 || slices.Contains(perSource[b], "1.1.1.1:443") {
+		t.Errorf("%s sent %v, want 2 of its own targets", b, perSource[b])
+	}
+	if sourceTargetCounts[a] != 2 || sourceTargetCounts[b] != 2 {
+		t.Errorf("sourceTargetCounts = %v", sourceTargetCounts)
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// nodeTemplate 表示一个用于生成新节点的模板分享链接
+type nodeTemplate struct {
+	node     *shareNode     // 通用字段：协议、服务器、SNI、传输方式等
+	user     string         // vless/vmess 的 uuid，trojan/hysteria2 的密码
+	query    url.Values     // URL 形式链接的参数
+	vmess    map[string]any // vmess 的 JSON 配置
+	method   string         // ss 加密方式
+	password string         // ss 密码
+}
+
+// templateCommentPattern 匹配模板行末以空白隔开的 # 注释，链接自身的 #名称 中可以含有空格
+var templateCommentPattern = regexp.MustCompile(`\s+#(\s.*)?$`)
+
+// readNodeTemplates 读取 -template 参数：可以是包含分享链接的文件，也可以是链接本身，每行一个链接，
+// # 开头的行和行末的 " # 注释" 被忽略
+func readNodeTemplates(spec string) ([]*nodeTemplate, error) {
+	content := spec
+	if data, err := os.ReadFile(spec); err == nil {
+		content = string(data)
+	}
+	var templates []*nodeTemplate
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		link := strings.TrimSpace(templateCommentPattern.ReplaceAllString(scanner.Text(), ""))
+		if link == "" || strings.HasPrefix(link, "#") {
+			continue
+		}
+		t, err := parseNodeTemplate(link)
+		if err != nil {
+			return nil, fmt.Errorf("模板链接无效: %w", err)
+		}
+		templates = append(templates, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("未找到模板链接")
+	}
+	return templates, nil
+}
+
+// parseNodeTemplate 解析模板链接，在分享链接通用字段之外保留凭据等生成新节点所需的信息
+func parseNodeTemplate(link string) (*nodeTemplate, error) {
+	node, err := parseShareLink(link)
+	if err != nil {
+		return nil, err
+	}
+	t := &nodeTemplate{node: node}
+	switch node.scheme {
+	case "vmess":
+		payload, _, _ := strings.Cut(strings.TrimPrefix(link, "vmess://"), "#")
+		data, err := decodeBase64(payload)
+		if err != nil {
+			return nil, fmt.Errorf("仅支持 base64 JSON 形式的 vmess 模板")
+		}
+		if err := json.Unmarshal(data, &t.vmess); err != nil {
+			return nil, err
+		}
+		t.user = mapString(t.vmess, "id")
+	case "ss":
+		rest, _, _ := strings.Cut(strings.TrimPrefix(link, "ss://"), "#")
+		userInfo := rest
+		if at := strings.LastIndex(rest, "@"); at != -1 {
+			userInfo = rest[:at]
+		} else if data, err := decodeBase64(strings.TrimSuffix(rest, "/")); err == nil {
+			// 旧版 ss://base64(method:password@host:port)
+			userInfo = string(data)
+			if at := strings.LastIndex(userInfo, "@"); at != -1 {
+				userInfo = userInfo[:at]
+			}
+		}
+		if data, err := decodeBase64(userInfo); err == nil && strings.Contains(string(data), ":") {
+			userInfo = string(data)
+		} else if unescaped, err := url.PathUnescape(userInfo); err == nil {
+			userInfo = unescaped
+		}
+		t.method, t.password, _ = strings.Cut(userInfo, ":")
+		_, query, _ := strings.Cut(rest, "?")
+		t.query, _ = url.ParseQuery(query)
+	default:
+		u, err := url.Parse(firstHopPort(link))
+		if err != nil {
+			return nil, err
+		}
+		t.user = u.User.Username()
+		if password, ok := u.User.Password(); ok {
+			t.user += ":" + password
+		}
+		t.query = u.Query()
+	}
+	return t, nil
+}
+
+// rewritten 返回替换服务器、端口和名称后的节点字段；原服务器为域名且未指定 SNI/Host 时，
+// 用原域名补全，保证换成IP后 TLS 和 CDN 回源仍然正确
+func (t *nodeTemplate) rewritten(server string, port int, name string) shareNode {
+	n := *t.node
+	if _, err := netip.ParseAddr(n.server); err != nil {
+		if n.sni == "" && n.security != "" && n.security != "none" {
+			n.sni = n.server
+		}
+		if n.host == "" && (n.network == "ws" || n.network == "httpupgrade" || n.network == "h2" || n.network == "http") {
+			n.host = n.server
+		}
+	}
+	n.server, n.port, n.name = server, port, name
+	return n
+}
+
+// link 生成替换后的分享链接
+func (t *nodeTemplate) link(server string, port int, name string) string {
+	n := t.rewritten(server, port, name)
+	hostPort := net.JoinHostPort(server, strconv.Itoa(port))
+	switch n.scheme {
+	case "vmess":
+		v := make(map[string]any, len(t.vmess))
+		for k, val := range t.vmess {
+			v[k] = val
+		}
+		v["add"], v["ps"], v["sni"], v["host"] = server, name, n.sni, n.host
+		if _, isString := t.vmess["port"].(string); isString {
+			v["port"] = strconv.Itoa(port)
+		} else {
+			v["port"] = port
+		}
+		data, _ := json.Marshal(v)
+		return "vmess://" + base64.StdEncoding.EncodeToString(data)
+	case "ss":
+		userInfo := base64.RawURLEncoding.EncodeToString([]byte(t.method + ":" + t.password))
+		link := "ss://" + userInfo + "@" + hostPort
+		if len(t.query) > 0 {
+			link += "/?" + t.query.Encode()
+		}
+		return link + "#" + url.PathEscape(name)
+	default:
+		query := url.Values{}
+		for k, v := range t.query {
+			query[k] = v
+		}
+		if n.sni != "" {
+			query.Set("sni", n.sni)
+		}
+		if n.host != "" {
+			query.Set("host", n.host)
+		}
+		u := url.URL{Scheme: n.scheme, Host: hostPort, RawQuery: query.Encode(), Fragment: name}
+		if user, password, ok := strings.Cut(t.user, ":"); ok {
+			u.User = url.UserPassword(user, password)
+		} else if t.user != "" {
+			u.User = url.User(t.user)
+		}
+		return u.String()
+	}
+}
+
+// clashProxy 生成 Clash/Mihomo proxies 条目
+func (t *nodeTemplate) clashProxy(server string, port int, name string) map[string]any {
+	n := t.rewritten(server, port, name)
+	p := map[string]any{"name": name, "type": n.scheme, "server": server, "port": port, "udp": true}
+	tls := n.security == "tls" || n.security == "reality"
+	switch n.scheme {
+	case "vmess":
+		p["uuid"] = t.user
+		p["alterId"] = mapPort(t.vmess, "aid")
+		p["cipher"] = firstNonEmpty(mapString(t.vmess, "scy"), "auto")
+		p["tls"] = tls
+	case "vless":
+		p["uuid"] = t.user
+		p["tls"] = tls
+		if flow := t.query.Get("flow"); flow != "" {
+			p["flow"] = flow
+		}
+	case "trojan":
+		p["password"] = t.user
+	case "hysteria2":
+		p["password"] = t.user
+		if obfs := t.query.Get("obfs"); obfs != "" {
+			p["obfs"] = obfs
+			p["obfs-password"] = t.query.Get("obfs-password")
+		}
+	case "ss":
+		p["cipher"] = t.method
+		p["password"] = t.password
+		return p
+	default:
+		p["password"] = t.user
+	}
+	if n.sni != "" {
+		if n.scheme == "vmess" || n.scheme == "vless" {
+			p["servername"] = n.sni
+		} else {
+			p["sni"] = n.sni
+		}
+	}
+	if t.query.Get("allowInsecure") == "1" || t.query.Get("insecure") == "1" {
+		p["skip-cert-verify"] = true
+	}
+	if fp := t.query.Get("fp"); fp != "" {
+		p["client-fingerprint"] = fp
+	}
+	if n.security == "reality" {
+		p["reality-opts"] = map[string]any{"public-key": t.query.Get("pbk"), "short-id": t.query.Get("sid")}
+	}
+	switch n.network {
+	case "ws":
+		p["network"] = "ws"
+		opts := map[string]any{"path": firstNonEmpty(n.path, "/")}
+		if n.host != "" {
+			opts["headers"] = map[string]any{"Host": n.host}
+		}
+		p["ws-opts"] = opts
+	case "grpc":
+		p["network"] = "grpc"
+		p["grpc-opts"] = map[string]any{"grpc-service-name": n.path}
+	}
+	return p
+}
+
+// singBoxOutbound 生成 sing-box 出站配置
+func (t *nodeTemplate) singBoxOutbound(server string, port int, name string) map[string]any {
+	n := t.rewritten(server, port, name)
+	o := map[string]any{"type": n.scheme, "tag": name, "server": server, "server_port": port}
+	switch n.scheme {
+	case "vmess":
+		o["uuid"] = t.user
+		o["alter_id"] = mapPort(t.vmess, "aid")
+		o["security"] = firstNonEmpty(mapString(t.vmess, "scy"), "auto")
+	case "vless":
+		o["uuid"] = t.user
+		if flow := t.query.Get("flow"); flow != "" {
+			o["flow"] = flow
+		}
+	case "ss":
+		o["type"] = "shadowsocks"
+		o["method"] = t.method
+		o["password"] = t.password
+		return o
+	case "hysteria2":
+		o["password"] = t.user
+		if obfs := t.query.Get("obfs"); obfs != "" {
+			o["obfs"] = map[string]any{"type": obfs, "password": t.query.Get("obfs-password")}
+		}
+	default:
+		o["password"] = t.user
+	}
+	if n.security == "tls" || n.security == "reality" || n.scheme == "trojan" || n.scheme == "hysteria2" {
+		tls := map[string]any{"enabled": true}
+		if n.sni != "" {
+			tls["server_name"] = n.sni
+		}
+		if t.query.Get("allowInsecure") == "1" || t.query.Get("insecure") == "1" {
+			tls["insecure"] = true
+		}
+		if fp := t.query.Get("fp"); fp != "" {
+			tls["utls"] = map[string]any{"enabled": true, "fingerprint": fp}
+		}
+		if n.security == "reality" {
+			tls["reality"] = map[string]any{"enabled": true, "public_key": t.query.Get("pbk"), "short_id": t.query.Get("sid")}
+		}
+		o["tls"] = tls
+	}
+	switch n.network {
+	case "ws", "httpupgrade":
+		transport := map[string]any{"type": n.network, "path": firstNonEmpty(n.path, "/")}
+		if n.host != "" {
+			if n.network == "ws" {
+				transport["headers"] = map[string]any{"Host": n.host}
+			} else {
+				transport["host"] = n.host
+			}
+		}
+		o["transport"] = transport
+	case "grpc":
+		o["transport"] = map[string]any{"type": "grpc", "service_name": n.path}
+	}
+	return o
+}
+
+// rewrittenNodeName 生成新节点名称：国旗、数据中心、延迟和速度，多个模板时加上模板名称前缀
+func rewrittenNodeName(t *nodeTemplate, res speedtestresult, multiple bool) string {
+	name := fmt.Sprintf("%s %s %dms", getCountryFlag(res.result.cca1), res.result.dataCenter, res.result.tcpDuration.Milliseconds())
+	if *speedTest > 0 {
+		name += fmt.Sprintf(" %.2fMB/s", res.downloadSpeed)
+	}
+	if multiple && t.node.name != "" {
+		name = t.node.name + " | " + name
+	}
+	return name
+}
+
+// writeRewrittenNodes 用排名靠前的结果替换模板节点的服务器地址和端口，
+// 输出分享链接、base64 订阅、Clash proxy-provider 和 sing-box 出站四个文件
+func writeRewrittenNodes(results []speedtestresult) error {
+	templates, err := readNodeTemplates(*templateLinks)
+	if err != nil {
+		return err
+	}
+
+	var links []string
+	var clashProxies, singBoxOutbounds []map[string]any
+	count := 0
+	for _, res := range results {
+		if count >= *nodeCount {
+			break
+		}
+		if *speedTest > 0 && res.downloadSpeed < float64(*speedLimit) {
+			continue
+		}
+		count++
+		for _, t := range templates {
+			name := rewrittenNodeName(t, res, len(templates) > 1)
+			links = append(links, t.link(res.result.target.Host(), res.result.target.Port(), name))
+			clashProxies = append(clashProxies, t.clashProxy(res.result.target.Host(), res.result.target.Port(), name))
+			singBoxOutbounds = append(singBoxOutbounds, t.singBoxOutbound(res.result.target.Host(), res.result.target.Port(), name))
+		}
+	}
+	if len(links) == 0 {
+		return fmt.Errorf("没有可用于生成节点的结果")
+	}
+
+	linkText := strings.Join(links, "\n") + "\n"
+	clashYAML, err := yaml.Marshal(map[string]any{"proxies": clashProxies})
+	if err != nil {
+		return err
+	}
+	singBoxJSON, err := json.MarshalIndent(map[string]any{"outbounds": singBoxOutbounds}, "", "  ")
+	if err != nil {
+		return err
+	}
+	files := []struct {
+		path string
+		data []byte
+	}{
+		{*nodeOut + ".txt", []byte(linkText)},
+		{*nodeOut + "_base64.txt", []byte(base64.StdEncoding.EncodeToString([]byte(linkText)))},
+		{*nodeOut + "_clash.yaml", clashYAML},
+		{*nodeOut + "_singbox.json", singBoxJSON},
+	}
+	for _, f := range files {
+		if err := os.WriteFile(f.path, f.data, 0644); err != nil {
+			return fmt.Errorf("写入 %s 失败: %w", f.path, err)
+		}
+	}
+	fmt.Printf("已根据 %d 个模板和前 %d 个结果生成 %d 个节点: %s.txt、%s_base64.txt、%s_clash.yaml、%s_singbox.json\n",
+		len(templates), count, len(links), *nodeOut, *nodeOut, *nodeOut, *nodeOut)
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadNodeTemplates(t *testing.T) {
+	vmess := "vmess://" + base64.StdEncoding.EncodeToString([]byte(`{"ps":"vm","add":"cdn.example.com","port":"443","id":"uuid","net":"ws","tls":"tls"}`))
+	content := "# 模板\n" +
+		"vless://uuid@cdn.example.com:443?type=ws&security=tls&path=%2Fws#香港 01\n" +
+		"\n" +
+		"  trojan://pass@1.2.3.4:8443?sni=t.example.com#trojan node   # 备用节点\n" +
+		vmess + "\r\n"
+	path := filepath.Join(t.TempDir(), "template.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	templates, err := readNodeTemplates(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ scheme, server, name string }{
+		{"vless", "cdn.example.com", "香港 01"},
+		{"trojan", "1.2.3.4", "trojan node"},
+		{"vmess", "cdn.example.com", "vm"},
+	}
+	if len(templates) != len(want) {
+		t.Fatalf("read %d templates, want %d", len(templates), len(want))
+	}
+	for i, w := range want {
+		n := templates[i].node
+		if n.scheme != w.scheme || n.server != w.server || n.name != w.name {
+			t.Errorf("template %d = %s %s %q, want %s %s %q", i, n.scheme, n.server, n.name, w.scheme, w.server, w.name)
+		}
+	}
+
+	// 参数本身就是链接
+	templates, err = readNodeTemplates("ss://YWVzLTI1Ni1nY206cGFzcw@1.2.3.4:8388#my node")
+	if err != nil || len(templates) != 1 || templates[0].node.name != "my node" || templates[0].password != "pass" {
+		t.Errorf("inline template = %+v, %v", templates, err)
+	}
+
+	for _, spec := range []string{"", "# only a comment", "vless://uuid@:443"} {
+		if _, err := readNodeTemplates(spec); err == nil {
+			t.Errorf("readNodeTemplates(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestNodeTemplateLink(t *testing.T) {
+	tests := []struct {
+		template string
+		server   string
+		want     string
+	}{
+		{
+			// 原服务器为域名时用其补全 SNI 和 Host
+			"vless://uuid@cdn.example.com:443?type=ws&security=tls&path=%2Fws#old",
+			"104.16.1.2",
+			"vless://uuid@104.16.1.2:2053?host=cdn.example.com&path=%2Fws&security=tls&sni=cdn.example.com&type=ws#%E9%A6%99%E6%B8%AF%201",
+		},
+		{
+			"trojan://pass@1.2.3.4:443?sni=t.example.com#old",
+			"2606:4700::1",
+			"trojan://pass@[2606:4700::1]:2053?sni=t.example.com#%E9%A6%99%E6%B8%AF%201",
+		},
+		{
+			"ss://YWVzLTI1Ni1nY206cGFzcw@1.2.3.4:8388#old",
+			"104.16.1.2",
+			"ss://YWVzLTI1Ni1nY206cGFzcw@104.16.1.2:2053#%E9%A6%99%E6%B8%AF%201",
+		},
+	}
+	for _, tt := range tests {
+		tmpl, err := parseNodeTemplate(tt.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tmpl.link(tt.server, 2053, "香港 1"); got != tt.want {
+			t.Errorf("link(%s) =\n  %s\nwant\n  %s", tt.template, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"math/rand/v2"
+	"net/netip"
+	"time"
+)
+
+// 抽样模式
+const (
+	sampleRandom = "random" // 每个子网随机抽取K个
+	sampleFirst  = "first"  // 每个子网取前K个
+	sampleLast   = "last"   // 每个子网取后K个
+	sampleStride = "stride" // 每个子网等间隔取K个
+)
+
+var (
+	sampleRng      *rand.Rand
+	sampleSeedUsed uint64
+	sampledSubnets int // 参与抽样的子网数量
+	sampledAddrs   int // 抽样得到的地址数量
+)
+
+// validSampleMode 检查抽样模式是否受支持
+func validSampleMode(mode string) bool {
+	switch mode {
+	case "", sampleRandom, sampleFirst, sampleLast, sampleStride:
+		return true
+	}
+	return false
+}
+
+// getSampleRng 返回抽样使用的随机数生成器，-seed 为0时使用当前时间并打印出来以便复现
+func getSampleRng() *rand.Rand {
+	if sampleRng == nil {
+		sampleSeedUsed = uint64(*sampleSeed)
+		if sampleSeedUsed == 0 {
+			sampleSeedUsed = uint64(time.Now().UnixNano())
+		}
+		fmt.Printf("抽样随机种子: %d (使用 -seed=%d 可复现本次抽样)\n", sampleSeedUsed, sampleSeedUsed)
+		sampleRng = rand.New(rand.NewPCG(sampleSeedUsed, sampleSeedUsed))
+	}
+	return sampleRng
+}
+
+// samplePrefixBits 返回区间所属地址族的抽样子网前缀长度
+func samplePrefixBits(r ipRange) int {
+	if r.start.Is4() {
+		return *samplePrefix4
+	}
+	return *samplePrefix6
+}
+
+// subnetCount 返回区间覆盖的子网数量，超出 uint64 时返回最大值
+func subnetCount(r ipRange, prefixBits int) uint64 {
+	shift := uint(r.start.BitLen() - prefixBits)
+	sh, sl := addrUint128(r.start)
+	eh, el := addrUint128(r.end)
+	sh, sl = shr128(sh, sl, shift)
+	eh, el = shr128(eh, el, shift)
+	lo, borrow := bits.Sub64(el, sl, 0)
+	hi, _ := bits.Sub64(eh, sh, borrow)
+	if hi != 0 || lo == ^uint64(0) {
+		return ^uint64(0)
+	}
+	return lo + 1
+}
+
+// sampleRangeCount 估算区间抽样后的地址数量，用于和 -maxexpand 比较
+func sampleRangeCount(r ipRange) uint64 {
+	subnets := subnetCount(r, samplePrefixBits(r))
+	hi, lo := bits.Mul64(subnets, uint64(*sampleK))
+	if hi != 0 {
+		return ^uint64(0)
+	}
+	if size := rangeSize(r); size < lo {
+		return size
+	}
+	return lo
+}
+
+// sampleRange 按子网对区间抽样，抽中的目标交给 emit，返回抽取的数量
+func sampleRange(r ipRange, emit func(Target)) int {
+	count := 0
+	prefixBits := samplePrefixBits(r)
+	for subnetStart := r.start; subnetStart.IsValid(); {
+		prefix, _ := subnetStart.Prefix(prefixBits)
+		lo, hi := subnetStart, lastAddr(prefix)
+		if r.end.Less(hi) {
+			hi = r.end
+		}
+		for _, addr := range sampleSubnet(lo, hi) {
+			emit(r.target(addr))
+			count++
+		}
+		sampledSubnets++
+		if hi == r.end {
+			break
+		}
+		subnetStart = hi.Next()
+	}
+	sampledAddrs += count
+	return count
+}
+
+// sampleSubnet 在 [lo, hi] 内按 -sample 模式取出至多 -samplek 个地址
+func sampleSubnet(lo, hi netip.Addr) []netip.Addr {
+	k := uint64(*sampleK)
+	size := rangeSize(ipRange{start: lo, end: hi})
+	if size <= k {
+		var addrs []netip.Addr
+		for addr := lo; ; addr = addr.Next() {
+			addrs = append(addrs, addr)
+			if addr == hi {
+				return addrs
+			}
+		}
+	}
+
+	addrs := make([]netip.Addr, 0, k)
+	switch *sampleMode {
+	case sampleFirst:
+		for i := uint64(0); i < k; i++ {
+			addrs = append(addrs, addrAdd(lo, 0, i))
+		}
+	case sampleLast:
+		for i := uint64(0); i < k; i++ {
+			addrs = append(addrs, addrSub(hi, i))
+		}
+	case sampleStride:
+		// 步长按 128 位计算，IPv6 大子网也能均匀覆盖
+		sizeHi, sizeLo := rangeSpan(lo, hi)
+		stepHi := sizeHi / k
+		stepLo, _ := bits.Div64(sizeHi%k, sizeLo, k)
+		for i := uint64(0); i < k; i++ {
+			carry, offLo := bits.Mul64(stepLo, i)
+			addrs = append(addrs, addrAdd(lo, stepHi*i+carry, offLo))
+		}
+	default:
+		// 区间大小超过 uint64 时（IPv6 大子网），按 128 位随机偏移抽取
+		sizeHi, sizeLo := rangeSpan(lo, hi)
+		rng := getSampleRng()
+		seen := make(map[[2]uint64]bool, k)
+		for uint64(len(addrs)) < k {
+			offHi, offLo := randUint128(rng, sizeHi, sizeLo)
+			key := [2]uint64{offHi, offLo}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			addrs = append(addrs, addrAdd(lo, offHi, offLo))
+		}
+	}
+	return addrs
+}
+
+// rangeSpan 返回 hi-lo+1 的 128 位表示（溢出时为全 1）
+func rangeSpan(lo, hi netip.Addr) (uint64, uint64) {
+	lh, ll := addrUint128(lo)
+	hh, hl := addrUint128(hi)
+	dl, borrow := bits.Sub64(hl, ll, 0)
+	dh, _ := bits.Sub64(hh, lh, borrow)
+	sl, carry := bits.Add64(dl, 1, 0)
+	sh, overflow := bits.Add64(dh, 0, carry)
+	if overflow != 0 {
+		return ^uint64(0), ^uint64(0)
+	}
+	return sh, sl
+}
+
+// randUint128 返回 [0, n) 内均匀分布的 128 位随机数。
+// n 的高 64 位为全 1 时（如 -sample6 0 下的 ::/0）高位直接取完整的 64 位随机数，避免 nHi+1 溢出
+func randUint128(rng *rand.Rand, nHi, nLo uint64) (uint64, uint64) {
+	if nHi == 0 {
+		return 0, rng.Uint64N(nLo)
+	}
+	for {
+		var hi uint64
+		if nHi == ^uint64(0) {
+			hi = rng.Uint64()
+		} else {
+			hi = rng.Uint64N(nHi + 1)
+		}
+		lo := rng.Uint64()
+		if hi < nHi || lo < nLo {
+			return hi, lo
+		}
+	}
+}
+
+// addrAdd 返回 a 加上 128 位偏移后的地址
+func addrAdd(a netip.Addr, offHi, offLo uint64) netip.Addr {
+	h, l := addrUint128(a)
+	l, carry := bits.Add64(l, offLo, 0)
+	h, _ = bits.Add64(h, offHi, carry)
+	return addrFromUint128(h, l, a.Is4())
+}
+
+// addrSub 返回 a 减去偏移后的地址
+func addrSub(a netip.Addr, off uint64) netip.Addr {
+	h, l := addrUint128(a)
+	l, borrow := bits.Sub64(l, off, 0)
+	h, _ = bits.Sub64(h, 0, borrow)
+	return addrFromUint128(h, l, a.Is4())
+}
+
+// addrFromUint128 由 128 位整数构造地址，is4 为 true 时返回 IPv4 地址
+func addrFromUint128(hi, lo uint64, is4 bool) netip.Addr {
+	var b [16]byte
+	for i := 7; i >= 0; i-- {
+		b[i] = byte(hi)
+		b[i+8] = byte(lo)
+		hi >>= 8
+		lo >>= 8
+	}
+	addr := netip.AddrFrom16(b)
+	if is4 {
+		return addr.Unmap()
+	}
+	return addr
+}
+
+// shr128 对 128 位整数右移
+func shr128(hi, lo uint64, n uint) (uint64, uint64) {
+	switch {
+	case n == 0:
+		return hi, lo
+	case n >= 128:
+		return 0, 0
+	case n >= 64:
+		return 0, hi >> (n - 64)
+	default:
+		return hi >> n, lo>>n | hi<<(64-n)
+	}
+}
+
+// shl128 对 128 位整数左移
+func shl128(hi, lo uint64, n uint) (uint64, uint64) {
+	switch {
+	case n == 0:
+		return hi, lo
+	case n >= 128:
+		return 0, 0
+	case n >= 64:
+		return lo << (n - 64), 0
+	default:
+		return hi<<n | lo>>(64-n), lo << n
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"math"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+// withSampleFlags 设置抽样参数并重置随机数生成器，测试结束后恢复
+func withSampleFlags(t *testing.T, mode string, k, prefix4, prefix6 int, seed int64) {
+	t.Helper()
+	oldMode, oldK, old4, old6, oldSeed := *sampleMode, *sampleK, *samplePrefix4, *samplePrefix6, *sampleSeed
+	oldRng, oldSubnets, oldAddrs := sampleRng, sampledSubnets, sampledAddrs
+	*sampleMode, *sampleK, *samplePrefix4, *samplePrefix6, *sampleSeed = mode, k, prefix4, prefix6, seed
+	sampleRng = nil
+	t.Cleanup(func() {
+		*sampleMode, *sampleK, *samplePrefix4, *samplePrefix6, *sampleSeed = oldMode, oldK, old4, old6, oldSeed
+		sampleRng, sampledSubnets, sampledAddrs = oldRng, oldSubnets, oldAddrs
+	})
+}
+
+// sampleAddrs 对区间抽样并返回抽中的地址
+func sampleAddrs(t *testing.T, spec string) []string {
+	t.Helper()
+	var addrs []string
+	sampleRange(testRange(t, spec, 443), func(target Target) {
+		addrs = append(addrs, target.AddrPort.Addr().String())
+	})
+	return addrs
+}
+
+func TestSampleRangeModes(t *testing.T) {
+	tests := []struct {
+		mode string
+		k    int
+		spec string
+		want []string
+	}{
+		{sampleFirst, 2, "10.0.0.0/23", []string{"10.0.0.0", "10.0.0.1", "10.0.1.0", "10.0.1.1"}},
+		{sampleLast, 2, "10.0.0.0/23", []string{"10.0.0.255", "10.0.0.254", "10.0.1.255", "10.0.1.254"}},
+		{sampleStride, 4, "10.0.0.0/24", []string{"10.0.0.0", "10.0.0.64", "10.0.0.128", "10.0.0.192"}},
+		// 区间不按子网边界对齐时只在区间内抽取
+		{sampleFirst, 1, "10.0.0.200-10.0.2.5", []string{"10.0.0.200", "10.0.1.0", "10.0.2.0"}},
+		{sampleLast, 1, "10.0.0.200-10.0.2.5", []string{"10.0.0.255", "10.0.1.255", "10.0.2.5"}},
+		// 子网地址数不超过 K 时全部取出
+		{sampleStride, 8, "10.0.0.0/30", []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{sampleStride, 2, "2606:4700::/47", []string{"2606:4700::", "2606:4700:0:8000::", "2606:4700:1::", "2606:4700:1:8000::"}},
+	}
+	for _, tt := range tests {
+		withSampleFlags(t, tt.mode, tt.k, 24, 48, 1)
+		if got := sampleAddrs(t, tt.spec); !slices.Equal(got, tt.want) {
+			t.Errorf("-sample %s -samplek %d %s = %v, want %v", tt.mode, tt.k, tt.spec, got, tt.want)
+		}
+	}
+
+	// -sample4 0 / -sample6 0 时整个区间为一个子网，::/0 的跨度为 2^128
+	for _, mode := range []string{sampleRandom, sampleFirst, sampleLast, sampleStride} {
+		for _, spec := range []string{"::/0", "::1-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", "0.0.0.0/0"} {
+			withSampleFlags(t, mode, 4, 0, 0, 1)
+			got := sampleAddrs(t, spec)
+			seen := make(map[string]bool)
+			for _, s := range got {
+				seen[s] = true
+			}
+			if len(got) != 4 || len(seen) != 4 {
+				t.Errorf("-sample %s -sample6 0 %s = %v, want 4 distinct addresses", mode, spec, got)
+			}
+			if spec == "::1-ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff" && seen["::"] {
+				t.Errorf("-sample %s %s sampled :: outside the range", mode, spec)
+			}
+		}
+	}
+}
+
+func TestSampleRandomSeed(t *testing.T) {
+	tests := []struct {
+		spec    string
+		subnets int
+	}{
+		{"104.16.0.0/20", 16},
+		{"2606:4700::/44", 16},
+	}
+	for _, tt := range tests {
+		withSampleFlags(t, sampleRandom, 3, 24, 48, 42)
+		first := sampleAddrs(t, tt.spec)
+		withSampleFlags(t, sampleRandom, 3, 24, 48, 42)
+		second := sampleAddrs(t, tt.spec)
+		withSampleFlags(t, sampleRandom, 3, 24, 48, 43)
+		other := sampleAddrs(t, tt.spec)
+
+		if len(first) != tt.subnets*3 {
+			t.Fatalf("%s: sampled %d addresses, want %d", tt.spec, len(first), tt.subnets*3)
+		}
+		if !slices.Equal(first, second) {
+			t.Errorf("%s: same seed gave different samples", tt.spec)
+		}
+		if slices.Equal(first, other) {
+			t.Errorf("%s: different seeds gave the same sample", tt.spec)
+		}
+		prefix := netip.MustParsePrefix(tt.spec)
+		seen := make(map[string]bool)
+		for i, s := range first {
+			addr := netip.MustParseAddr(s)
+			if !prefix.Contains(addr) || seen[s] {
+				t.Errorf("%s: sample %s is outside the range or repeated", tt.spec, s)
+			}
+			seen[s] = true
+			// 每个子网抽取 K 个，按子网顺序输出
+			bits := 24
+			if addr.Is6() {
+				bits = 48
+			}
+			if p, _ := addr.Prefix(bits); i%3 != 0 && !p.Contains(netip.MustParseAddr(first[i-1])) {
+				t.Errorf("%s: %s not in the same subnet as %s", tt.spec, s, first[i-1])
+			}
+		}
+	}
+}
+
+func TestSampleRangeCount(t *testing.T) {
+	tests := []struct {
+		spec string
+		k    int
+		want uint64
+	}{
+		{"104.16.0.0/20", 1, 16},
+		{"104.16.0.0/20", 3, 48},
+		{"10.0.0.0/30", 8, 4},
+		{"10.0.0.200-10.0.2.5", 1, 3},
+		{"2606:4700::/32", 2, 1 << 17},
+		{"::/0", 2, 1 << 49},
+		{"::/0", 1 << 20, math.MaxUint64},
+	}
+	for _, tt := range tests {
+		withSampleFlags(t, sampleRandom, tt.k, 24, 48, 1)
+		if got := sampleRangeCount(testRange(t, tt.spec, 443)); got != tt.want {
+			t.Errorf("sampleRangeCount(%s, k=%d) = %d, want %d", tt.spec, tt.k, got, tt.want)
+		}
+	}
+
+	// -sample4 0 / -sample6 0：整个区间只算一个子网
+	for _, spec := range []string{"::/0", "0.0.0.0/0", "104.16.0.0/13"} {
+		withSampleFlags(t, sampleRandom, 5, 0, 0, 1)
+		if got := sampleRangeCount(testRange(t, spec, 443)); got != 5 {
+			t.Errorf("sampleRangeCount(%s, prefix 0) = %d, want 5", spec, got)
+		}
+	}
+}
+
+func TestShift128(t *testing.T) {
+	tests := []struct {
+		hi, lo uint64
+		n      uint
+		shr    [2]uint64
+		shl    [2]uint64
+	}{
+		{1, 1, 0, [2]uint64{1, 1}, [2]uint64{1, 1}},
+		{1, 1, 1, [2]uint64{0, 1 << 63}, [2]uint64{2, 2}},
+		{1, 1 << 63, 64, [2]uint64{0, 1}, [2]uint64{1 << 63, 0}},
+		{1 << 63, 0, 127, [2]uint64{0, 1}, [2]uint64{0, 0}},
+		{math.MaxUint64, math.MaxUint64, 128, [2]uint64{0, 0}, [2]uint64{0, 0}},
+	}
+	for _, tt := range tests {
+		if h, l := shr128(tt.hi, tt.lo, tt.n); [2]uint64{h, l} != tt.shr {
+			t.Errorf("shr128(%#x, %#x, %d) = %#x, %#x", tt.hi, tt.lo, tt.n, h, l)
+		}
+		if h, l := shl128(tt.hi, tt.lo, tt.n); [2]uint64{h, l} != tt.shl {
+			t.Errorf("shl128(%#x, %#x, %d) = %#x, %#x", tt.hi, tt.lo, tt.n, h, l)
+		}
+	}
+}
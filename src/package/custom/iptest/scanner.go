@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 扫描器输出格式
+const (
+	formatNmapXML     = "nmap XML"
+	formatNmapGrep    = "nmap grepable"
+	formatMasscanXML  = "masscan XML"
+	formatMasscanJSON = "masscan JSON"
+	formatMasscanList = "masscan list"
+	formatMasscanGrep = "masscan grepable"
+)
+
+// detectScanFormat 根据扩展名和开头内容识别 nmap/masscan 输出格式，无法识别时返回空
+func detectScanFormat(filePath string, head []byte) string {
+	trimmed := bytes.TrimSpace(head)
+	ext := sourceExt(filePath)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("<?xml")) || bytes.HasPrefix(trimmed, []byte("<nmaprun")):
+		if bytes.Contains(head, []byte(`scanner="masscan"`)) {
+			return formatMasscanXML
+		}
+		if bytes.Contains(head, []byte("<nmaprun")) || ext == ".xml" {
+			return formatNmapXML
+		}
+	case bytes.HasPrefix(trimmed, []byte("# Nmap")) && bytes.Contains(head, []byte("-oG")),
+		ext == ".gnmap":
+		return formatNmapGrep
+	case bytes.HasPrefix(trimmed, []byte("[")) && bytes.Contains(head, []byte(`"ports"`)):
+		return formatMasscanJSON
+	case bytes.HasPrefix(trimmed, []byte("#masscan")):
+		return formatMasscanList
+	case bytes.HasPrefix(trimmed, []byte("# Masscan")):
+		return formatMasscanGrep
+	}
+	return ""
+}
+
+// nmapHost 对应 nmap -oX 与 masscan -oX 中的 host 元素
+type nmapHost struct {
+	Addresses []struct {
+		Addr     string `xml:"addr,attr"`
+		AddrType string `xml:"addrtype,attr"`
+	} `xml:"address"`
+	Ports []struct {
+		Protocol string `xml:"protocol,attr"`
+		PortID   int    `xml:"portid,attr"`
+		State    struct {
+			State string `xml:"state,attr"`
+		} `xml:"state"`
+	} `xml:"ports>port"`
+}
+
+// readScanOutput 按格式流式解析扫描器输出，只保留状态为 open 的 TCP 端口，每个端口调用一次 emit，
+// 返回解析出的数量。逐行或逐个 host 读取，内存占用与扫描结果的大小无关
+func readScanOutput(format string, r io.Reader, emit func(Target)) (int, error) {
+	count := 0
+	add := func(addr string, port int) {
+		if port <= 0 || port >= 65536 {
+			return
+		}
+		if t, err := newTarget(addr, port); err == nil {
+			count++
+			emit(t)
+		}
+	}
+	var err error
+	switch format {
+	case formatNmapXML, formatMasscanXML:
+		err = readNmapXML(r, add)
+	case formatNmapGrep, formatMasscanGrep:
+		err = readGrepable(r, add)
+	case formatMasscanJSON:
+		err = readMasscanJSON(r, add)
+	case formatMasscanList:
+		err = readMasscanList(r, add)
+	default:
+		err = fmt.Errorf("未知的扫描器格式: %s", format)
+	}
+	return count, err
+}
+
+// readNmapXML 逐个 host 元素解析 nmap/masscan 的 XML 输出
+func readNmapXML(r io.Reader, add func(addr string, port int)) error {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("XML解析失败: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "host" {
+			continue
+		}
+		var host nmapHost
+		if err := decoder.DecodeElement(&host, &start); err != nil {
+			return fmt.Errorf("XML解析失败: %w", err)
+		}
+		addr := ""
+		for _, a := range host.Addresses {
+			if a.AddrType == "ipv4" || a.AddrType == "ipv6" {
+				addr = a.Addr
+				break
+			}
+		}
+		if addr == "" {
+			continue
+		}
+		for _, port := range host.Ports {
+			if port.Protocol == "tcp" && port.State.State == "open" {
+				add(addr, port.PortID)
+			}
+		}
+	}
+}
+
+// nmapGrepPortPattern 匹配 nmap -oG 中 Ports 字段的单个端口: 443/open/tcp//https///
+var nmapGrepPortPattern = regexp.MustCompile(`^(\d+)/([a-z|]+)/([a-z]+)/`)
+
+// readGrepable 逐行解析 nmap -oG 和 masscan -oG 输出，如:
+// Host: 1.1.1.1 ()	Ports: 80/open/tcp//http///, 443/open/tcp//https///
+// Timestamp: 1700000000	Host: 1.1.1.1 ()	Ports: 443/open/tcp//https//
+func readGrepable(r io.Reader, add func(addr string, port int)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var host []string
+		var portList string
+		for _, field := range strings.Split(scanner.Text(), "\t") {
+			field = strings.TrimSpace(field)
+			if value, ok := strings.CutPrefix(field, "Host: "); ok {
+				host = strings.Fields(value)
+			} else if value, ok := strings.CutPrefix(field, "Ports: "); ok {
+				portList = value
+			}
+		}
+		if len(host) == 0 || portList == "" {
+			continue
+		}
+		for _, item := range strings.Split(portList, ",") {
+			matches := nmapGrepPortPattern.FindStringSubmatch(strings.TrimSpace(item))
+			if len(matches) != 4 || matches[2] != "open" || matches[3] != "tcp" {
+				continue
+			}
+			if p, err := strconv.Atoi(matches[1]); err == nil {
+				add(host[0], p)
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// masscanRecord masscan -oJ 中的一条记录
+type masscanRecord struct {
+	IP    string `json:"ip"`
+	Ports []struct {
+		Port   int    `json:"port"`
+		Proto  string `json:"proto"`
+		Status string `json:"status"`
+	} `json:"ports"`
+}
+
+// readMasscanJSON 逐条解析 masscan -oJ 输出的 JSON 数组，兼容旧版本最后一条记录后多余的逗号
+func readMasscanJSON(r io.Reader, add func(addr string, port int)) error {
+	decoder := json.NewDecoder(r)
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return fmt.Errorf("JSON解析失败: 不是 masscan -oJ 输出的数组")
+	}
+	for decoder.More() {
+		var record masscanRecord
+		if err := decoder.Decode(&record); err != nil {
+			// 旧版输出以 "},\n]" 结尾，多余的逗号之后只剩数组结束符
+			rest, _ := io.ReadAll(io.LimitReader(io.MultiReader(decoder.Buffered(), r), 16))
+			if _, isSyntax := err.(*json.SyntaxError); isSyntax && strings.Trim(string(rest), " \t\r\n,]") == "" {
+				return nil
+			}
+			return fmt.Errorf("JSON解析失败: %w", err)
+		}
+		for _, port := range record.Ports {
+			if port.Proto == "tcp" && port.Status == "open" {
+				add(record.IP, port.Port)
+			}
+		}
+	}
+	return nil
+}
+
+// readMasscanList 逐行解析 masscan -oL 输出: open tcp 443 1.1.1.1 1700000000
+func readMasscanList(r io.Reader, add func(addr string, port int)) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[0] != "open" || fields[1] != "tcp" {
+			continue
+		}
+		if p, err := strconv.Atoi(fields[2]); err == nil {
+			add(fields[3], p)
+		}
+	}
+	return scanner.Err()
+}
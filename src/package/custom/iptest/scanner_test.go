@@ -0,0 +1,178 @@
+package main
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadScanOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		format  string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "nmap xml",
+			path: "scan.xml",
+			content: `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE nmaprun>
+<nmaprun scanner="nmap" args="nmap -p443,8443 -oX scan.xml">
+<host><status state="up"/><address addr="1.1.1.1" addrtype="ipv4"/><address addr="00:11:22:33:44:55" addrtype="mac"/>
+<ports><port protocol="tcp" portid="443"><state state="open"/></port>
+<port protocol="tcp" portid="8443"><state state="filtered"/></port>
+<port protocol="udp" portid="53"><state state="open"/></port></ports></host>
+<host><address addr="2606:4700::1" addrtype="ipv6"/><ports><port protocol="tcp" portid="2053"><state state="open"/></port></ports></host>
+</nmaprun>`,
+			format: formatNmapXML,
+			want:   []string{"1.1.1.1:443", "[2606:4700::1]:2053"},
+		},
+		{
+			name: "masscan xml",
+			path: "scan.xml",
+			content: `<?xml version="1.0"?>
+<nmaprun scanner="masscan" start="1700000000" version="1.0-BETA">
+<host endtime="1700000000"><address addr="104.16.1.2" addrtype="ipv4"/><ports><port protocol="tcp" portid="2083"><state state="open" reason="syn-ack"/></port></ports></host>
+</nmaprun>`,
+			format: formatMasscanXML,
+			want:   []string{"104.16.1.2:2083"},
+		},
+		{
+			name: "nmap grepable",
+			path: "scan.txt",
+			content: "# Nmap 7.94 scan initiated as: nmap -p 80,443 -oG scan.txt 1.1.1.0/30\n" +
+				"Host: 1.1.1.1 ()\tStatus: Up\n" +
+				"Host: 1.1.1.1 ()\tPorts: 80/open/tcp//http///, 443/open/tcp//https///, 8443/closed/tcp/////\tIgnored State: filtered (997)\n" +
+				"Host: 1.1.1.2 (one.example)\tPorts: 53/open/udp//domain///\n" +
+				"# Nmap done at Mon -- 4 IP addresses (1 host up) scanned\n",
+			format: formatNmapGrep,
+			want:   []string{"1.1.1.1:80", "1.1.1.1:443"},
+		},
+		{
+			name: "masscan grepable",
+			path: "scan.txt",
+			content: "# Masscan 1.3.2 scan initiated Mon Jan  1 00:00:00 2024\n" +
+				"# Ports scanned: TCP(2;443-444) UDP(0;) SCTP(0;) PROTOCOLS(0;)\n" +
+				"Timestamp: 1700000000\tHost: 104.16.1.2 ()\tPorts: 443/open/tcp//https//\n" +
+				"Timestamp: 1700000001\tHost: 104.16.1.3 ()\tPorts: 444/open/tcp////\n" +
+				"# Masscan done at Mon Jan  1 00:00:10 2024\n",
+			format: formatMasscanGrep,
+			want:   []string{"104.16.1.2:443", "104.16.1.3:444"},
+		},
+		{
+			name: "masscan json array",
+			path: "scan.json",
+			content: `[{"ip": "104.16.1.2", "ports": [{"port": 443, "proto": "tcp", "status": "open"}, {"port": 53, "proto": "udp", "status": "open"}]},
+{"ip": "104.16.1.3", "ports": [{"port": 8443, "proto": "tcp", "status": "closed"}, {"port": 2053, "proto": "tcp", "status": "open"}]}]`,
+			format: formatMasscanJSON,
+			want:   []string{"104.16.1.2:443", "104.16.1.3:2053"},
+		},
+		{
+			name: "masscan json with trailing comma",
+			path: "scan.json",
+			content: "[\n" +
+				`{   "ip": "104.16.1.2",   "timestamp": "1700000000", "ports": [ {"port": 443, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 57} ] }` + ",\n" +
+				`{   "ip": "104.16.1.3",   "timestamp": "1700000000", "ports": [ {"port": 443, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 57} ] }` + ",\n" +
+				"]\n",
+			format: formatMasscanJSON,
+			want:   []string{"104.16.1.2:443", "104.16.1.3:443"},
+		},
+		{
+			name: "masscan list",
+			path: "scan.lst",
+			content: "#masscan\n" +
+				"open tcp 443 104.16.1.2 1700000000\n" +
+				"open tcp 70000 104.16.1.3 1700000000\n" +
+				"open udp 53 104.16.1.4 1700000000\n" +
+				"open tcp 2053 2606:4700::1 1700000000\n" +
+				"# end\n",
+			format: formatMasscanList,
+			want:   []string{"104.16.1.2:443", "[2606:4700::1]:2053"},
+		},
+		{
+			name:    "truncated json",
+			path:    "scan.json",
+			content: `[{"ip": "104.16.1.2", "ports": [{"port": 443, "proto": "tcp", "status": "open"}]}, {"ip": "1.1`,
+			format:  formatMasscanJSON,
+			want:    []string{"104.16.1.2:443"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		head := []byte(tt.content)
+		if len(head) > 4096 {
+			head = head[:4096]
+		}
+		if format := detectScanFormat(tt.path, head); format != tt.format {
+			t.Errorf("%s: detectScanFormat() = %q, want %q", tt.name, format, tt.format)
+			continue
+		}
+		var got []string
+		count, err := readScanOutput(tt.format, strings.NewReader(tt.content), func(target Target) {
+			got = append(got, target.String())
+		})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: readScanOutput() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if !slices.Equal(got, tt.want) || count != len(tt.want) {
+			t.Errorf("%s: readScanOutput() = %d %v, want %v", tt.name, count, got, tt.want)
+		}
+	}
+}
+
+func TestDetectScanFormatPlainList(t *testing.T) {
+	for _, content := range []string{"1.1.1.1 443\n", "# 注释\n1.1.1.1\n", "[2606:4700::1]:443\n"} {
+		if format := detectScanFormat("ip.txt", []byte(content)); format != "" {
+			t.Errorf("detectScanFormat(%q) = %q, want plain list", content, format)
+		}
+	}
+}
+
+// TestReadScanOutputStreams 确认读到一条记录就输出目标，不必等读完整个输入
+func TestReadScanOutputStreams(t *testing.T) {
+	tests := []struct {
+		format      string
+		first, rest string
+	}{
+		{formatMasscanList, "open tcp 443 104.16.1.2 1700000000\n", "open tcp 443 104.16.1.3 1700000000\n"},
+		{formatNmapGrep, "Host: 104.16.1.2 ()\tPorts: 443/open/tcp//https///\n", "Host: 104.16.1.3 ()\tPorts: 443/open/tcp//https///\n"},
+		{formatNmapXML,
+			`<nmaprun><host><address addr="104.16.1.2" addrtype="ipv4"/><ports><port protocol="tcp" portid="443"><state state="open"/></port></ports></host>`,
+			`<host><address addr="104.16.1.3" addrtype="ipv4"/><ports><port protocol="tcp" portid="443"><state state="open"/></port></ports></host></nmaprun>`},
+		{formatMasscanJSON,
+			`[{"ip": "104.16.1.2", "ports": [{"port": 443, "proto": "tcp", "status": "open"}]}` + "\n",
+			`,{"ip": "104.16.1.3", "ports": [{"port": 443, "proto": "tcp", "status": "open"}]}]`},
+	}
+	for _, tt := range tests {
+		r, w := io.Pipe()
+		emitted := make(chan string, 2)
+		done := make(chan error, 1)
+		go func() {
+			_, err := readScanOutput(tt.format, r, func(target Target) { emitted <- target.String() })
+			done <- err
+		}()
+
+		w.Write([]byte(tt.first))
+		select {
+		case got := <-emitted:
+			if got != "104.16.1.2:443" {
+				t.Errorf("%s: first target = %s", tt.format, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: no target emitted before the input ended", tt.format)
+		}
+		w.Write([]byte(tt.rest))
+		w.Close()
+		if err := <-done; err != nil {
+			t.Errorf("%s: readScanOutput() error = %v", tt.format, err)
+		}
+		if got := <-emitted; got != "104.16.1.3:443" {
+			t.Errorf("%s: second target = %s", tt.format, got)
+		}
+	}
+}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchHit 搜索引擎返回的一条结果
+type searchHit struct {
+	IP      string `json:"ip"`
+	Port    int    `json:"port"`
+	Domain  string `json:"domain,omitempty"`
+	ASN     string `json:"asn,omitempty"`
+	Org     string `json:"org,omitempty"`
+	Country string `json:"country,omitempty"`
+}
+
+// searchEngine 一个网络空间搜索引擎后端。API 密钥由环境变量 <名称>_KEY 提供，
+// <名称>_API 可替换默认的 API 地址（用于代理或本地测试桩）
+type searchEngine struct {
+	name     string
+	baseURL  string // 默认 API 地址
+	pageSize int    // 每页最大结果数
+	// fetch 获取第 page 页（从1开始）的结果，返回本页结果和结果总数
+	fetch func(c *searchClient, query string, page, size int) (hits []searchHit, total int, err error)
+}
+
+// searchEngines 支持的搜索引擎
+var searchEngines = map[string]*searchEngine{
+	"fofa":    {name: "fofa", baseURL: "https://fofa.info", pageSize: 1000, fetch: fetchFofa},
+	"hunter":  {name: "hunter", baseURL: "https://hunter.qianxin.com", pageSize: 100, fetch: fetchHunter},
+	"quake":   {name: "quake", baseURL: "https://quake.360.net", pageSize: 500, fetch: fetchQuake},
+	"zoomeye": {name: "zoomeye", baseURL: "https://api.zoomeye.ai", pageSize: 100, fetch: fetchZoomEye},
+	"shodan":  {name: "shodan", baseURL: "https://api.shodan.io", pageSize: 100, fetch: fetchShodan},
+}
+
+// searchClient 调用搜索引擎 API 的客户端
+type searchClient struct {
+	engine  *searchEngine
+	key     string
+	baseURL string
+	http    *http.Client
+}
+
+// searchColumn 可输出到结果文件的搜索结果字段，取自目标的附加信息
+type searchColumn struct {
+	key    string // 附加信息的键
+	header string // 输出列名
+}
+
+// searchColumns 可通过 -searchcols 输出的列，按输出顺序排列
+var searchColumns = []searchColumn{
+	{"asn", "ASN"},
+	{"org", "ASN组织"},
+	{"country", "搜索国家"},
+}
+
+// selectedSearchColumns 解析 -searchcols 指定的输出列：all 表示全部，或逗号分隔的字段名
+func selectedSearchColumns(spec string) ([]searchColumn, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	if spec == "all" {
+		return searchColumns, nil
+	}
+	var cols []searchColumn
+	for _, key := range strings.Split(spec, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		i := slices.IndexFunc(searchColumns, func(c searchColumn) bool { return c.key == key })
+		if i == -1 {
+			return nil, fmt.Errorf("不支持的搜索字段: %s，可选 asn、org、country 或 all", key)
+		}
+		cols = append(cols, searchColumns[i])
+	}
+	return cols, nil
+}
+
+// searchSleep 限流重试和翻页间隔的等待，测试中可替换
+var searchSleep = time.Sleep
+
+// searchMaxRetries 遇到限流（429/503）时的最大重试次数
+const searchMaxRetries = 3
+
+// newSearchClient 读取环境变量中的密钥和 API 地址，创建搜索客户端
+func newSearchClient(name string) (*searchClient, error) {
+	engine, ok := searchEngines[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("不支持的搜索引擎: %s，可选 fofa、hunter、quake、zoomeye、shodan", name)
+	}
+	env := strings.ToUpper(engine.name)
+	key := os.Getenv(env + "_KEY")
+	if key == "" {
+		return nil, fmt.Errorf("未设置 %s_KEY 环境变量", env)
+	}
+	return &searchClient{
+		engine:  engine,
+		key:     key,
+		baseURL: strings.TrimSuffix(firstNonEmpty(os.Getenv(env+"_API"), engine.baseURL), "/"),
+		http:    &http.Client{Timeout: *fetchTimeout},
+	}, nil
+}
+
+// do 发送请求并返回响应内容。遇到限流时按 Retry-After（或指数退避）等待后重试
+func (c *searchClient) do(method, path string, params url.Values, body any, header map[string]string) ([]byte, error) {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	for attempt := 0; ; attempt++ {
+		rawURL := c.baseURL + path
+		if len(params) > 0 {
+			rawURL += "?" + params.Encode()
+		}
+		req, err := http.NewRequest(method, rawURL, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", "Mozilla/5.0")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := c.http.Do(req)
+		if err != nil {
+			// 不输出请求地址，避免密钥出现在日志中
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			return nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, *fetchMaxMB<<20))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) && attempt < searchMaxRetries {
+			wait := time.Duration(1<<attempt) * time.Second
+			if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+				wait = time.Duration(s) * time.Second
+			}
+			fmt.Printf("%s 请求被限流 (HTTP %d)，%v 后重试\n", c.engine.name, resp.StatusCode, wait)
+			searchSleep(wait)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("HTTP状态码 %d: %s", resp.StatusCode, truncate(string(data), 200))
+		}
+		return data, nil
+	}
+}
+
+// truncate 截断过长的字符串用于提示信息
+func truncate(s string, n int) string {
+	s = strings.TrimSpace(s)
+	if len(s) > n {
+		return s[:n] + "..."
+	}
+	return s
+}
+
+// fetchFofa 查询 FOFA：GET /api/v1/search/all，查询语句 base64 编码
+func fetchFofa(c *searchClient, query string, page, size int) ([]searchHit, int, error) {
+	params := url.Values{
+		"key":     {c.key},
+		"qbase64": {base64.StdEncoding.EncodeToString([]byte(query))},
+		"fields":  {"ip,port,host,as_number,as_organization,country"},
+		"page":    {strconv.Itoa(page)},
+		"size":    {strconv.Itoa(size)},
+	}
+	data, err := c.do("GET", "/api/v1/search/all", params, nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	var resp struct {
+		Error   bool    `json:"error"`
+		ErrMsg  string  `json:"errmsg"`
+		Size    int     `json:"size"`
+		Results [][]any `json:"results"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, 0, fmt.Errorf("响应解析失败: %w", err)
+	}
+	if resp.Error {
+		return nil, 0, fmt.Errorf("%s", resp.ErrMsg)
+	}
+	hits := make([]searchHit, 0, len(resp.Results))
+	for _, row := range resp.Results {
+		if len(row) < 6 {
+			continue
+		}
+		port, _ := strconv.Atoi(anyString(row[1]))
+		hits = append(hits, searchHit{
+			IP: anyString(row[0]), Port: port, Domain: hostDomain(anyString(row[2])),
+			ASN: anyString(row[3]), Org: anyString(row[4]), Country: anyString(row[5]),
+		})
+	}
+	return hits, resp.Size, nil
+}
+
+// fetchHunter 查询奇安信鹰图：GET /openApi/search，查询语句 base64url 编码
+func fetchHunter(c *searchClient, query string, page, size int) ([]searchHit, int, error) {
+	params := url.Values{
+		"api-key":   {c.key},
+		"search":    {base64.URLEncoding.EncodeToString([]byte(query))},
+		"page":      {strconv.Itoa(page)},
+		"page_size": {strconv.Itoa(size)},
+		"is_web":    {"3"},
+	}
+	data, err := c.do("GET", "/openApi/search", params, nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	var resp struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			Total     int              `json:"total"`
+			RestQuota string           `json:"rest_quota"`
+			Arr       []map[string]any `json:"arr"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, 0, fmt.Errorf("响应解析失败: %w", err)
+	}
+	if resp.Code != 200 {
+		return nil, 0, fmt.Errorf("%d %s", resp.Code, resp.Message)
+	}
+	if resp.Data.RestQuota != "" {
+		fmt.Printf("hunter %s\n", resp.Data.RestQuota)
+	}
+	hits := make([]searchHit, 0, len(resp.Data.Arr))
+	for _, item := range resp.Data.Arr {
+		hits = append(hits, searchHit{
+			IP: mapString(item, "ip"), Port: mapPort(item, "port"), Domain: mapString(item, "domain"),
+			ASN: mapString(item, "as_number"), Org: firstNonEmpty(mapString(item, "as_org"), mapString(item, "isp")),
+			Country: mapString(item, "country"),
+		})
+	}
+	return hits, resp.Data.Total, nil
+}
+
+// fetchQuake 查询 360 Quake：POST /api/v3/search/quake_service，密钥放在 X-QuakeToken 头中
+func fetchQuake(c *searchClient, query string, page, size int) ([]searchHit, int, error) {
+	body := map[string]any{"query": query, "start": (page - 1) * size, "size": size}
+	data, err := c.do("POST", "/api/v3/search/quake_service", nil, body, map[string]string{"X-QuakeToken": c.key})
+	if err != nil {
+		return nil, 0, err
+	}
+	var resp struct {
+		Code    any              `json:"code"`
+		Message string           `json:"message"`
+		Data    []map[string]any `json:"data"`
+		Meta    struct {
+			Pagination struct {
+				Total int `json:"total"`
+			} `json:"pagination"`
+		} `json:"meta"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, 0, fmt.Errorf("响应解析失败: %w", err)
+	}
+	if code := fmt.Sprint(resp.Code); code != "0" {
+		return nil, 0, fmt.Errorf("%s %s", code, resp.Message)
+	}
+	hits := make([]searchHit, 0, len(resp.Data))
+	for _, item := range resp.Data {
+		location := mapMap(item, "location")
+		hits = append(hits, searchHit{
+			IP: mapString(item, "ip"), Port: mapPort(item, "port"),
+			Domain: firstNonEmpty(mapString(item, "domain"), mapString(item, "hostname")),
+			ASN:    mapString(item, "asn"), Org: mapString(item, "org"),
+			Country: firstNonEmpty(mapString(location, "country_code"), mapString(location, "country_en"),
+				mapString(location, "country_cn")),
+		})
+	}
+	return hits, resp.Meta.Pagination.Total, nil
+}
+
+// fetchZoomEye 查询 ZoomEye：POST /v2/search，查询语句 base64 编码，密钥放在 API-KEY 头中
+func fetchZoomEye(c *searchClient, query string, page, size int) ([]searchHit, int, error) {
+	body := map[string]any{
+		"qbase64":  base64.StdEncoding.EncodeToString([]byte(query)),
+		"page":     page,
+		"pagesize": size,
+		"fields":   "ip,port,domain,asn,organization.name,country.name",
+	}
+	data, err := c.do("POST", "/v2/search", nil, body, map[string]string{"API-KEY": c.key})
+	if err != nil {
+		return nil, 0, err
+	}
+	var resp struct {
+		Code    int              `json:"code"`
+		Message string           `json:"message"`
+		Total   int              `json:"total"`
+		Data    []map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, 0, fmt.Errorf("响应解析失败: %w", err)
+	}
+	if resp.Code != 60000 {
+		return nil, 0, fmt.Errorf("%d %s", resp.Code, resp.Message)
+	}
+	hits := make([]searchHit, 0, len(resp.Data))
+	for _, item := range resp.Data {
+		hits = append(hits, searchHit{
+			IP: mapString(item, "ip"), Port: mapPort(item, "port"), Domain: mapString(item, "domain"),
+			ASN: mapString(item, "asn"), Org: mapString(item, "organization.name"), Country: mapString(item, "country.name"),
+		})
+	}
+	return hits, resp.Total, nil
+}
+
+// fetchShodan 查询 Shodan：GET /shodan/host/search，每页固定 100 条，每页消耗 1 个查询额度
+func fetchShodan(c *searchClient, query string, page, size int) ([]searchHit, int, error) {
+	params := url.Values{"key": {c.key}, "query": {query}, "page": {strconv.Itoa(page)}}
+	data, err := c.do("GET", "/shodan/host/search", params, nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	var resp struct {
+		Error   string           `json:"error"`
+		Total   int              `json:"total"`
+		Matches []map[string]any `json:"matches"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, 0, fmt.Errorf("响应解析失败: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, 0, fmt.Errorf("%s", resp.Error)
+	}
+	hits := make([]searchHit, 0, len(resp.Matches))
+	for _, item := range resp.Matches {
+		hit := searchHit{
+			IP: mapString(item, "ip_str"), Port: mapPort(item, "port"),
+			ASN: strings.TrimPrefix(strings.ToUpper(mapString(item, "asn")), "AS"), Org: mapString(item, "org"),
+			Country: mapString(mapMap(item, "location"), "country_code"),
+		}
+		if names, ok := item["hostnames"].([]any); ok && len(names) > 0 {
+			hit.Domain = fmt.Sprint(names[0])
+		}
+		hits = append(hits, hit)
+	}
+	return hits, resp.Total, nil
+}
+
+// hostDomain 从 FOFA 的 host 字段（如 https://a.example.com:8443）中取出域名，是 IP 时返回空
+func hostDomain(host string) string {
+	if u, err := url.Parse(host); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if !validHostname(host) {
+		return ""
+	}
+	return host
+}
+
+// search 分页查询直到结果取完或达到 -searchmax，每页之间间隔 -searchdelay。
+// 中途出错（如额度用尽）时保留已获取的结果
+func (c *searchClient) search(query string) ([]searchHit, error) {
+	limit := *searchMax
+	// 各页大小保持一致，否则按页码计算的偏移会错位；最后一页多出的结果截掉
+	size := c.engine.pageSize
+	if limit < size {
+		size = limit
+	}
+	var hits []searchHit
+	for page := 1; len(hits) < limit; page++ {
+		if page > 1 && *searchDelay > 0 {
+			searchSleep(*searchDelay)
+		}
+		pageHits, total, err := c.engine.fetch(c, query, page, size)
+		if err != nil {
+			if len(hits) > 0 {
+				fmt.Printf("%s 第 %d 页查询失败: %v，保留已获取的 %d 条\n", c.engine.name, page, err, len(hits))
+				break
+			}
+			return nil, err
+		}
+		hits = append(hits, pageHits...)
+		fmt.Printf("%s 第 %d 页: %d 条 (累计 %d / 共 %d)\n", c.engine.name, page, len(pageHits), len(hits), total)
+		if len(pageHits) == 0 || len(hits) >= total {
+			break
+		}
+	}
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// searchCachePath 返回搜索结果的缓存文件路径
+func searchCachePath(engine, query string) string {
+	return remoteCachePath(fmt.Sprintf("search:%s:%d:%s", engine, *searchMax, query)) + ".json"
+}
+
+// readSearch 执行一条搜索（格式 引擎:查询语句），将结果转换为带 ASN、组织和国家信息的目标。
+// 结果写入缓存：离线模式直接使用缓存，查询失败时回退到上次缓存
+func readSearch(spec string, emit func(Target)) (int, error) {
+	name, query, ok := strings.Cut(strings.TrimSpace(spec), ":")
+	name, query = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(query)
+	if !ok || query == "" {
+		return 0, fmt.Errorf("搜索格式应为 引擎:查询语句: %s", spec)
+	}
+	cachePath := searchCachePath(name, query)
+
+	var hits []searchHit
+	var err error
+	if offlineMode {
+		err = fmt.Errorf("离线模式")
+	} else {
+		var client *searchClient
+		if client, err = newSearchClient(name); err == nil {
+			hits, err = client.search(query)
+		}
+	}
+	if err == nil {
+		if data, e := json.Marshal(hits); e == nil && os.MkdirAll(*cacheDir, 0755) == nil {
+			os.WriteFile(cachePath, data, 0644)
+		}
+	} else {
+		data, readErr := os.ReadFile(cachePath)
+		if readErr != nil || json.Unmarshal(data, &hits) != nil {
+			return 0, fmt.Errorf("%s 查询失败: %w", name, err)
+		}
+		fmt.Printf("%s 查询失败: %v，使用上次缓存的 %d 条结果\n", name, err, len(hits))
+	}
+
+	source := name + ":" + query
+	parseDiag.startFile(source)
+	parseDiag.begin(0, query)
+	parseDiag.match(name)
+	count := 0
+	for _, hit := range hits {
+		t, err := newTarget(hit.IP, hit.Port)
+		if err != nil {
+			continue
+		}
+		if hit.Domain != "" && t.Resolved() {
+			t.Hostname = hit.Domain
+		}
+		t.Source = source
+		t.setMeta("asn", hit.ASN)
+		t.setMeta("org", hit.Org)
+		t.setMeta("country", hit.Country)
+		parseDiag.target(t)
+		emit(t)
+		count++
+	}
+	parseDiag.end()
+	fmt.Printf("搜索 %s 得到 %d 条\n", source, count)
+	return count, nil
+}
+
+// readSearchList 读取 .search 文件中的搜索（每行一条，格式 引擎:查询语句，# 开头为注释）
+func readSearchList(listPath string, emit func(Target)) (int, error) {
+	file, err := os.Open(listPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	total := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		count, err := readSearch(line, emit)
+		total += count
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+	return total, scanner.Err()
+}
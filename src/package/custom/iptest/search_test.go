@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// searchFixture 测试桩返回的全部结果
+var searchFixture = func() []searchHit {
+	var hits []searchHit
+	for i := 1; i <= 5; i++ {
+		hits = append(hits, searchHit{
+			IP: fmt.Sprintf("104.16.0.%d", i), Port: 2050 + i, Domain: fmt.Sprintf("h%d.example.com", i),
+			ASN: "13335", Org: "Cloudflare", Country: "US",
+		})
+	}
+	return hits
+}()
+
+// searchStub 模拟一个搜索引擎：page 从请求中取出页码、每页大小和密钥，render 生成该页的响应
+type searchStub struct {
+	page   func(r *http.Request) (page, size int, key string)
+	render func(hits []searchHit, total int) any
+}
+
+// jsonBody 解析 POST 请求的 JSON 请求体
+func jsonBody(r *http.Request) map[string]any {
+	var body map[string]any
+	json.NewDecoder(r.Body).Decode(&body)
+	return body
+}
+
+// queryInt 读取查询参数中的整数
+func queryInt(r *http.Request, key string) int {
+	n, _ := strconv.Atoi(r.URL.Query().Get(key))
+	return n
+}
+
+var searchStubs = map[string]searchStub{
+	"fofa": {
+		page: func(r *http.Request) (int, int, string) {
+			return queryInt(r, "page"), queryInt(r, "size"), r.URL.Query().Get("key")
+		},
+		render: func(hits []searchHit, total int) any {
+			rows := [][]any{}
+			for _, h := range hits {
+				rows = append(rows, []any{h.IP, strconv.Itoa(h.Port), "https://" + h.Domain + ":" + strconv.Itoa(h.Port), h.ASN, h.Org, h.Country})
+			}
+			return map[string]any{"error": false, "size": total, "results": rows}
+		},
+	},
+	"hunter": {
+		page: func(r *http.Request) (int, int, string) {
+			return queryInt(r, "page"), queryInt(r, "page_size"), r.URL.Query().Get("api-key")
+		},
+		render: func(hits []searchHit, total int) any {
+			arr := []any{}
+			for _, h := range hits {
+				asn, _ := strconv.Atoi(h.ASN)
+				arr = append(arr, map[string]any{"ip": h.IP, "port": h.Port, "domain": h.Domain, "as_number": asn, "as_org": h.Org, "country": h.Country})
+			}
+			return map[string]any{"code": 200, "data": map[string]any{"total": total, "arr": arr}}
+		},
+	},
+	"quake": {
+		page: func(r *http.Request) (int, int, string) {
+			body := jsonBody(r)
+			start, size := int(body["start"].(float64)), int(body["size"].(float64))
+			return start/size + 1, size, r.Header.Get("X-QuakeToken")
+		},
+		render: func(hits []searchHit, total int) any {
+			data := []any{}
+			for _, h := range hits {
+				data = append(data, map[string]any{"ip": h.IP, "port": h.Port, "hostname": h.Domain, "asn": h.ASN, "org": h.Org,
+					"location": map[string]any{"country_code": h.Country, "country_cn": "美国"}})
+			}
+			return map[string]any{"code": 0, "data": data, "meta": map[string]any{"pagination": map[string]any{"total": total}}}
+		},
+	},
+	"zoomeye": {
+		page: func(r *http.Request) (int, int, string) {
+			body := jsonBody(r)
+			return int(body["page"].(float64)), int(body["pagesize"].(float64)), r.Header.Get("API-KEY")
+		},
+		render: func(hits []searchHit, total int) any {
+			data := []any{}
+			for _, h := range hits {
+				data = append(data, map[string]any{"ip": h.IP, "port": h.Port, "domain": h.Domain, "asn": h.ASN,
+					"organization.name": h.Org, "country.name": h.Country})
+			}
+			return map[string]any{"code": 60000, "total": total, "data": data}
+		},
+	},
+	"shodan": {
+		// Shodan 不支持指定每页大小，测试桩按客户端的 pageSize 分页
+		page: func(r *http.Request) (int, int, string) {
+			return queryInt(r, "page"), 2, r.URL.Query().Get("key")
+		},
+		render: func(hits []searchHit, total int) any {
+			matches := []any{}
+			for _, h := range hits {
+				matches = append(matches, map[string]any{"ip_str": h.IP, "port": h.Port, "hostnames": []any{h.Domain},
+					"asn": "AS" + h.ASN, "org": h.Org, "location": map[string]any{"country_code": h.Country}})
+			}
+			return map[string]any{"total": total, "matches": matches}
+		},
+	},
+}
+
+// withSearchFlags 设置 -searchmax、-searchdelay 并记录等待时长而不实际等待，测试结束后恢复
+func withSearchFlags(t *testing.T, max int) *[]time.Duration {
+	t.Helper()
+	savedMax, savedDelay, savedSleep := *searchMax, *searchDelay, searchSleep
+	t.Cleanup(func() { *searchMax, *searchDelay, searchSleep = savedMax, savedDelay, savedSleep })
+	*searchMax, *searchDelay = max, 10*time.Millisecond
+	var waits []time.Duration
+	searchSleep = func(d time.Duration) { waits = append(waits, d) }
+	return &waits
+}
+
+// stubSearchClient 启动搜索引擎测试桩，statuses 依次指定各次请求的响应状态码（不足时为 200），
+// 返回每页大小为 2 的客户端和实际请求的页码
+func stubSearchClient(t *testing.T, name string, statuses ...int) (*searchClient, *[]int) {
+	t.Helper()
+	stub := searchStubs[name]
+	var pages []int
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= len(statuses) && statuses[requests-1] != http.StatusOK {
+			if statuses[requests-1] == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "7")
+			}
+			http.Error(w, "slow down", statuses[requests-1])
+			return
+		}
+		page, size, key := stub.page(r)
+		if key != "secret" {
+			http.Error(w, "bad key "+key, http.StatusUnauthorized)
+			return
+		}
+		pages = append(pages, page)
+		start := min((page-1)*size, len(searchFixture))
+		end := min(start+size, len(searchFixture))
+		json.NewEncoder(w).Encode(stub.render(searchFixture[start:end], len(searchFixture)))
+	}))
+	t.Cleanup(server.Close)
+
+	engine := *searchEngines[name]
+	engine.pageSize = 2
+	return &searchClient{engine: &engine, key: "secret", baseURL: server.URL, http: server.Client()}, &pages
+}
+
+func TestSearchEnginesPaging(t *testing.T) {
+	for name := range searchEngines {
+		waits := withSearchFlags(t, 1000)
+		client, pages := stubSearchClient(t, name)
+		hits, err := client.search("asn=13335")
+		if err != nil {
+			t.Errorf("%s: search() error = %v", name, err)
+			continue
+		}
+		if !slices.Equal(hits, searchFixture) {
+			t.Errorf("%s: search() =\n  %+v\nwant\n  %+v", name, hits, searchFixture)
+		}
+		if !slices.Equal(*pages, []int{1, 2, 3}) {
+			t.Errorf("%s: requested pages %v, want [1 2 3]", name, *pages)
+		}
+		// 翻页之间按 -searchdelay 间隔
+		if !slices.Equal(*waits, []time.Duration{10 * time.Millisecond, 10 * time.Millisecond}) {
+			t.Errorf("%s: waits = %v", name, *waits)
+		}
+	}
+}
+
+func TestSearchMaxLimitsResults(t *testing.T) {
+	for name := range searchEngines {
+		withSearchFlags(t, 3)
+		client, pages := stubSearchClient(t, name)
+		hits, err := client.search("asn=13335")
+		if err != nil || !slices.Equal(hits, searchFixture[:3]) {
+			t.Errorf("%s: search() = %+v, %v", name, hits, err)
+		}
+		if !slices.Equal(*pages, []int{1, 2}) {
+			t.Errorf("%s: requested pages %v, want [1 2]", name, *pages)
+		}
+	}
+}
+
+func TestSearchRetry(t *testing.T) {
+	for name := range searchEngines {
+		// 429 按 Retry-After 等待，503 没有 Retry-After 时按 1s、2s 指数退避
+		waits := withSearchFlags(t, 2)
+		client, _ := stubSearchClient(t, name, http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+		hits, err := client.search("asn=13335")
+		if err != nil || !slices.Equal(hits, searchFixture[:2]) {
+			t.Errorf("%s: search() = %+v, %v", name, hits, err)
+		}
+		if want := []time.Duration{7 * time.Second, 2 * time.Second, 4 * time.Second}; !slices.Equal(*waits, want) {
+			t.Errorf("%s: waits = %v, want %v", name, *waits, want)
+		}
+
+		// 超过最大重试次数后返回错误
+		withSearchFlags(t, 2)
+		client, _ = stubSearchClient(t, name, slices.Repeat([]int{http.StatusTooManyRequests}, searchMaxRetries+1)...)
+		if _, err := client.search("asn=13335"); err == nil || !strings.Contains(err.Error(), "429") {
+			t.Errorf("%s: search() error = %v, want HTTP 429", name, err)
+		}
+	}
+}
+
+func TestSearchKeepsHitsOnLaterFailure(t *testing.T) {
+	for name := range searchEngines {
+		withSearchFlags(t, 1000)
+		client, _ := stubSearchClient(t, name, http.StatusOK, http.StatusForbidden)
+		hits, err := client.search("asn=13335")
+		if err != nil || !slices.Equal(hits, searchFixture[:2]) {
+			t.Errorf("%s: search() = %+v, %v", name, hits, err)
+		}
+	}
+}
+
+func TestReadSearch(t *testing.T) {
+	withSearchFlags(t, 1000)
+	savedCache := *cacheDir
+	t.Cleanup(func() { *cacheDir = savedCache })
+	*cacheDir = t.TempDir()
+
+	client, _ := stubSearchClient(t, "fofa")
+	t.Setenv("FOFA_KEY", "secret")
+	t.Setenv("FOFA_API", client.baseURL+"/")
+	var targets []Target
+	count, err := readSearch("FOFA: asn=13335", func(t Target) { targets = append(targets, t) })
+	if err != nil || count != len(searchFixture) {
+		t.Fatalf("readSearch() = %d, %v", count, err)
+	}
+	cols, err := selectedSearchColumns("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, target := range targets {
+		hit := searchFixture[i]
+		var values []string
+		for _, col := range cols {
+			values = append(values, target.meta(col.key))
+		}
+		if target.AddrPort.Addr().String() != hit.IP || target.Port() != hit.Port || target.Hostname != hit.Domain ||
+			target.Source != "fofa:asn=13335" || !slices.Equal(values, []string{"13335", "Cloudflare", "US"}) {
+			t.Errorf("target %d = %+v %v", i, target, values)
+		}
+	}
+
+	// 查询失败时回退到缓存
+	t.Setenv("FOFA_KEY", "wrong")
+	count, err = readSearch("fofa:asn=13335", func(Target) {})
+	if err != nil || count != len(searchFixture) {
+		t.Errorf("readSearch() with cache = %d, %v", count, err)
+	}
+	if _, err := readSearch("fofa:asn=1", func(Target) {}); err == nil {
+		t.Error("readSearch() succeeded without results or cache")
+	}
+	if _, err := readSearch("baidu:asn=1", func(Target) {}); err == nil {
+		t.Error("readSearch() accepted an unknown engine")
+	}
+}
+
+func TestSelectedSearchColumns(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{spec: "", want: nil},
+		{spec: "all", want: []string{"asn", "org", "country"}},
+		{spec: "country, asn,", want: []string{"country", "asn"}},
+		{spec: "asn,isp", wantErr: true},
+	}
+	for _, tt := range tests {
+		cols, err := selectedSearchColumns(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("selectedSearchColumns(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		var keys []string
+		for _, c := range cols {
+			keys = append(keys, c.key)
+		}
+		if !slices.Equal(keys, tt.want) {
+			t.Errorf("selectedSearchColumns(%q) = %v, want %v", tt.spec, keys, tt.want)
+		}
+	}
+}
+
+func TestFofaQueryEncoding(t *testing.T) {
+	withSearchFlags(t, 1)
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decoded, _ := base64.StdEncoding.DecodeString(r.URL.Query().Get("qbase64"))
+		query = string(decoded)
+		w.Write([]byte(`{"error": false, "size": 0, "results": []}`))
+	}))
+	defer server.Close()
+	client := &searchClient{engine: searchEngines["fofa"], key: "secret", baseURL: server.URL, http: server.Client()}
+	if _, err := client.search(`asn="13335" && port="443"`); err != nil || query != `asn="13335" && port="443"` {
+		t.Errorf("fofa query = %q, %v", query, err)
+	}
+}
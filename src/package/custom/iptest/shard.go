@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shardInfo 当前运行测试的分片。目标按去重键的哈希分配到 n 个分片，与输入顺序无关，
+// 因此同一目标集合每次划分的结果相同
+type shardInfo struct {
+	index    int  // 分片序号，从0开始
+	count    int  // 分片总数，0 表示不分片
+	rotating bool // 轮换模式：每次运行测试下一个分片
+}
+
+// shard 由 -shard 解析得到，未分片时 count 为 0
+var shard shardInfo
+
+// shardCursor 轮换模式保存的游标
+type shardCursor struct {
+	Count   int       `json:"count"`
+	Next    int       `json:"next"` // 下次运行测试的分片序号，从0开始
+	Updated time.Time `json:"updated"`
+}
+
+// shardTimeColumn 滚动结果文件中记录测试时间的列
+const shardTimeColumn = "测试时间"
+
+// parseShard 解析 -shard：i/n 测试第 i 个分片（1 ≤ i ≤ n），auto/n 从游标文件中读取本次要测试的分片
+func parseShard(spec string) (shardInfo, error) {
+	if spec == "" {
+		return shardInfo{}, nil
+	}
+	first, second, ok := strings.Cut(spec, "/")
+	n, err := strconv.Atoi(strings.TrimSpace(second))
+	if !ok || err != nil || n < 1 {
+		return shardInfo{}, fmt.Errorf("分片格式无效: %s，应为 i/n 或 auto/n", spec)
+	}
+	if strings.TrimSpace(first) == "auto" {
+		cursor := loadShardCursor()
+		next := 0
+		if cursor.Count == n && cursor.Next >= 0 && cursor.Next < n {
+			next = cursor.Next
+		}
+		return shardInfo{index: next, count: n, rotating: true}, nil
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(first))
+	if err != nil || i < 1 || i > n {
+		return shardInfo{}, fmt.Errorf("分片序号无效: %s，应在 1-%d 之间", spec, n)
+	}
+	return shardInfo{index: i - 1, count: n}, nil
+}
+
+// String 返回 "i/n" 形式的分片描述，序号从1开始
+func (s shardInfo) String() string {
+	return fmt.Sprintf("%d/%d", s.index+1, s.count)
+}
+
+// shardOf 返回去重键所属的分片
+func shardOf(key string, count int) int {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return int(h.Sum64() % uint64(count))
+}
+
+// contains 判断目标是否属于当前分片，未分片时总是返回 true
+func (s shardInfo) contains(t Target) bool {
+	return s.count <= 1 || shardOf(t.Key(), s.count) == s.index
+}
+
+// shardStatePath 返回游标文件路径，默认为输出文件加 .shard 后缀
+func shardStatePath() string {
+	if *shardState != "" {
+		return *shardState
+	}
+	return *outFile + ".shard"
+}
+
+// rollingFilePath 返回滚动结果文件路径，默认为输出文件名加 _rolling 后缀
+func rollingFilePath() string {
+	if *rollFile != "" {
+		return *rollFile
+	}
+	return strings.TrimSuffix(*outFile, ".csv") + "_rolling.csv"
+}
+
+// loadShardCursor 读取游标文件，不存在或无法解析时返回零值
+func loadShardCursor() shardCursor {
+	var cursor shardCursor
+	if data, err := os.ReadFile(shardStatePath()); err == nil {
+		json.Unmarshal(data, &cursor)
+	}
+	return cursor
+}
+
+// advanceShardCursor 本次分片测试完成后将游标移到下一个分片
+func advanceShardCursor() error {
+	cursor := shardCursor{Count: shard.count, Next: (shard.index + 1) % shard.count, Updated: time.Now()}
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(shardStatePath(), data, 0644)
+}
+
+// mergeRollingResults 将本次分片的结果合并到滚动结果文件：删除文件中属于本分片的旧结果（已重新测试，
+// 失效的目标随之移除），加入本次结果并记录测试时间，其他分片的结果原样保留。
+// 旧结果按列名对应到本次的列，按延迟从低到高排序；本次没有结果时沿用文件原有的列
+func mergeRollingResults(header []string, records [][]string) (int, error) {
+	path := rollingFilePath()
+	var old [][]string
+	if file, err := os.Open(path); err == nil {
+		old, err = csv.NewReader(file).ReadAll()
+		file.Close()
+		if err != nil {
+			return 0, fmt.Errorf("读取滚动结果文件 %s 时出错: %w", path, err)
+		}
+	}
+	if len(records) == 0 {
+		if len(old) == 0 {
+			return 0, nil
+		}
+		header = old[0]
+	} else {
+		header = append(append([]string(nil), header...), shardTimeColumn)
+	}
+
+	merged := make([][]string, 0, len(records))
+	now := time.Now().Format("2006-01-02 15:04:05")
+	for _, record := range records {
+		merged = append(merged, append(append([]string(nil), record...), now))
+	}
+
+	kept := 0
+	if len(old) > 0 {
+		index := make(map[string]int, len(old[0]))
+		for i, name := range old[0] {
+			index[name] = i
+		}
+		for _, row := range old[1:] {
+			get := func(name string) string {
+				if i, ok := index[name]; ok && i < len(row) {
+					return row[i]
+				}
+				return ""
+			}
+			port, _ := strconv.Atoi(get("端口"))
+			t, err := newTarget(get("IP地址"), port)
+			if err != nil || shard.contains(t) {
+				continue
+			}
+			record := make([]string, len(header))
+			for i, name := range header {
+				record[i] = get(name)
+			}
+			merged = append(merged, record)
+			kept++
+		}
+	}
+
+	latencyCol := -1
+	for i, name := range header {
+		if name == "网络延迟" {
+			latencyCol = i
+		}
+	}
+	if latencyCol >= 0 {
+		sort.SliceStable(merged, func(i, j int) bool {
+			a, _ := parseLatencyMs(merged[i][latencyCol])
+			b, _ := parseLatencyMs(merged[j][latencyCol])
+			return a < b
+		})
+	}
+
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	writer := csv.NewWriter(file)
+	writer.Write(header)
+	writer.WriteAll(merged)
+	file.Close()
+	if err := writer.Error(); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, err
+	}
+	fmt.Printf("已将分片 %s 的 %d 条结果合并到 %s (保留其他分片 %d 条)\n", shard, len(records), path, kept)
+	return len(merged), nil
+}
+
+// finishRotatingShard 轮换分片测试结束后合并滚动结果并将游标移到下一个分片，返回滚动结果数。
+// 本分片没有有效结果时同样执行，否则游标停在该分片，滚动结果中该分片的旧结果也不会清除
+func finishRotatingShard(header []string, records [][]string) int {
+	rollingCount, err := mergeRollingResults(header, records)
+	if err != nil {
+		fmt.Printf("合并滚动结果失败: %v\n", err)
+		return 0
+	}
+	if err := advanceShardCursor(); err != nil {
+		fmt.Printf("保存分片游标失败: %v\n", err)
+	}
+	return rollingCount
+}
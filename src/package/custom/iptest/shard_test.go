@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useTempOutFile 将输出文件指向临时目录，测试结束后恢复
+func useTempOutFile(t *testing.T) {
+	t.Helper()
+	oldOut, oldState, oldRoll, oldShard := *outFile, *shardState, *rollFile, shard
+	*outFile = filepath.Join(t.TempDir(), "ip.csv")
+	*shardState, *rollFile = "", ""
+	t.Cleanup(func() {
+		*outFile, *shardState, *rollFile, shard = oldOut, oldState, oldRoll, oldShard
+	})
+}
+
+func TestParseShard(t *testing.T) {
+	useTempOutFile(t)
+	tests := []struct {
+		spec    string
+		want    shardInfo
+		wantErr bool
+	}{
+		{"", shardInfo{}, false},
+		{"1/4", shardInfo{index: 0, count: 4}, false},
+		{"4/4", shardInfo{index: 3, count: 4}, false},
+		{" 2 / 3 ", shardInfo{index: 1, count: 3}, false},
+		{"auto/5", shardInfo{index: 0, count: 5, rotating: true}, false},
+		{"0/4", shardInfo{}, true},
+		{"5/4", shardInfo{}, true},
+		{"1/0", shardInfo{}, true},
+		{"1", shardInfo{}, true},
+		{"a/4", shardInfo{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseShard(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseShard(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseShard(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseShardCursor(t *testing.T) {
+	useTempOutFile(t)
+	shard = shardInfo{index: 1, count: 3, rotating: true}
+	if err := advanceShardCursor(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := parseShard("auto/3"); got.index != 2 {
+		t.Errorf("auto/3 after shard 2/3 = %s, want 3/3", got)
+	}
+	// 分片总数变化后游标从头开始
+	if got, _ := parseShard("auto/4"); got.index != 0 {
+		t.Errorf("auto/4 with a cursor saved for 3 shards = %s, want 1/4", got)
+	}
+}
+
+func TestShardOf(t *testing.T) {
+	tests := []struct {
+		key   string
+		count int
+		want  int
+	}{
+		// 分片取决于去重键的 FNV-1a 哈希，改动哈希会让已有的轮换游标和滚动结果错位
+		{"1.1.1.1:443", 1, 0},
+		{"1.1.1.1:443", 4, 2},
+		{"1.1.1.1:443", 7, 4},
+		{"104.16.0.1:8443", 4, 1},
+		{"[2606:4700::1]:443", 4, 2},
+		{"[2606:4700::1]:443", 7, 3},
+	}
+	for _, tt := range tests {
+		if got := shardOf(tt.key, tt.count); got != tt.want {
+			t.Errorf("shardOf(%q, %d) = %d, want %d", tt.key, tt.count, got, tt.want)
+		}
+	}
+
+	// 每个目标恰好属于一个分片，且各分片大致均匀
+	const n, total = 4, 4000
+	counts := make([]int, n)
+	for i := 0; i < total; i++ {
+		target, err := newTarget(fmt.Sprintf("10.%d.%d.%d", i>>16&255, i>>8&255, i&255), 443)
+		if err != nil {
+			t.Fatal(err)
+		}
+		owners := 0
+		for idx := 0; idx < n; idx++ {
+			if (shardInfo{index: idx, count: n}).contains(target) {
+				owners++
+				counts[idx]++
+			}
+		}
+		if owners != 1 {
+			t.Fatalf("%s belongs to %d shards", target.Key(), owners)
+		}
+	}
+	for idx, c := range counts {
+		if c < total/n*8/10 || c > total/n*12/10 {
+			t.Errorf("shard %d/%d has %d of %d targets", idx+1, n, c, total)
+		}
+	}
+}
+
+// readRolling 读取滚动结果文件
+func readRolling(t *testing.T) [][]string {
+	t.Helper()
+	file, err := os.Open(rollingFilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+// shardAddrs 返回属于指定分片的 IPv4 地址
+func shardAddrs(t *testing.T, s shardInfo, n int) []string {
+	t.Helper()
+	var addrs []string
+	for i := 1; len(addrs) < n && i < 255*255; i++ {
+		ip := fmt.Sprintf("10.0.%d.%d", i/255, i%255)
+		target, _ := newTarget(ip, 443)
+		if s.contains(target) {
+			addrs = append(addrs, ip)
+		}
+	}
+	return addrs
+}
+
+func TestFinishRotatingShard(t *testing.T) {
+	useTempOutFile(t)
+	header := []string{"IP地址", "端口", "网络延迟"}
+	first := shardInfo{index: 0, count: 2, rotating: true}
+	second := shardInfo{index: 1, count: 2, rotating: true}
+	a, b := shardAddrs(t, first, 2), shardAddrs(t, second, 1)
+
+	shard = first
+	if got := finishRotatingShard(header, [][]string{{a[0], "443", "30 ms"}, {a[1], "443", "10 ms"}}); got != 2 {
+		t.Fatalf("first shard merged %d rows, want 2", got)
+	}
+	shard = second
+	if got := finishRotatingShard(header, [][]string{{b[0], "443", "20 ms"}}); got != 3 {
+		t.Fatalf("second shard merged %d rows, want 3", got)
+	}
+	rows := readRolling(t)
+	if len(rows) != 4 || rows[1][0] != a[1] || rows[2][0] != b[0] || rows[3][0] != a[0] {
+		t.Fatalf("rolling rows not sorted by latency: %v", rows)
+	}
+
+	// 本分片没有有效结果：清除其旧结果，保留其他分片并轮换游标
+	shard, _ = parseShard("auto/2")
+	if shard != first {
+		t.Fatalf("cursor = %s, want 1/2", shard)
+	}
+	if got := finishRotatingShard(nil, nil); got != 1 {
+		t.Fatalf("empty shard left %d rows, want 1", got)
+	}
+	rows = readRolling(t)
+	if len(rows) != 2 || rows[0][len(rows[0])-1] != shardTimeColumn || rows[1][0] != b[0] {
+		t.Fatalf("rolling rows after empty shard = %v", rows)
+	}
+	if next, _ := parseShard("auto/2"); next != second {
+		t.Errorf("cursor after empty shard = %s, want 2/2", next)
+	}
+}
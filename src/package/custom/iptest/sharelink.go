@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// errUnsupportedScheme 表示链接协议不在支持列表中，交由其他格式继续解析
+var errUnsupportedScheme = errors.New("不支持的协议")
+
+// shareNode 表示一个从分享链接解析出的代理节点
+type shareNode struct {
+	scheme   string // 协议: vmess、vless、trojan、ss、hysteria2 等
+	server   string // 服务器地址
+	port     int    // 端口
+	name     string // 节点名称
+	sni      string // TLS SNI
+	host     string // 传输层 Host（ws/h2 等）
+	path     string // 传输层路径
+	network  string // 传输方式: tcp、ws、grpc 等
+	security string // tls、reality、none
+	link     string // 原始分享链接
+}
+
+// target 将节点转换为目标，节点名称作为标签，传输参数和原始链接保存在附加信息中
+func (n *shareNode) target() (Target, error) {
+	t, err := newTarget(n.server, n.port)
+	if err != nil {
+		return t, err
+	}
+	t.SNI = n.sni
+	t.Tag = n.name
+	t.setMeta("proto", n.scheme)
+	t.setMeta("host", n.host)
+	t.setMeta("path", n.path)
+	t.setMeta("type", n.network)
+	t.setMeta("security", n.security)
+	t.setMeta("link", n.link)
+	return t, nil
+}
+
+// parseShareLink 解析常见的代理分享链接
+func parseShareLink(link string) (*shareNode, error) {
+	scheme, rest, ok := strings.Cut(link, "://")
+	if !ok {
+		return nil, fmt.Errorf("不是分享链接")
+	}
+	scheme = strings.ToLower(scheme)
+	var node *shareNode
+	var err error
+	switch scheme {
+	case "vmess":
+		node, err = parseVmessLink(rest)
+	case "ss":
+		node, err = parseSSLink(rest)
+	case "vless", "trojan", "hysteria2", "hy2", "tuic", "hysteria", "anytls":
+		node, err = parseURLLink(link)
+	default:
+		return nil, errUnsupportedScheme
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s 链接解析失败: %w", scheme, err)
+	}
+	if scheme == "hy2" {
+		scheme = "hysteria2"
+	}
+	node.scheme = scheme
+	node.link = link
+	if node.server == "" || node.port <= 0 || node.port >= 65536 {
+		return nil, fmt.Errorf("%s 链接缺少有效的服务器地址或端口", scheme)
+	}
+	return node, nil
+}
+
+// parseURLLink 解析 URL 形式的链接: scheme://凭据@服务器:端口?参数#名称
+func parseURLLink(link string) (*shareNode, error) {
+	u, err := url.Parse(firstHopPort(link))
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	node := &shareNode{
+		server:   u.Hostname(),
+		name:     u.Fragment,
+		sni:      firstNonEmpty(query.Get("sni"), query.Get("peer"), query.Get("servername")),
+		host:     query.Get("host"),
+		path:     firstNonEmpty(query.Get("path"), query.Get("serviceName")),
+		network:  query.Get("type"),
+		security: query.Get("security"),
+	}
+	portStr := u.Port()
+	if portStr == "" {
+		portStr = "443"
+	}
+	if node.port, err = strconv.Atoi(portStr); err != nil {
+		return nil, fmt.Errorf("端口无效: %s", portStr)
+	}
+	return node, nil
+}
+
+// firstHopPort 将 hysteria2 等链接中的跳跃端口（如 443,8443-8450）替换为第一个端口，
+// 否则 url.Parse 无法解析
+func firstHopPort(link string) string {
+	scheme, rest, _ := strings.Cut(link, "://")
+	end := strings.IndexAny(rest, "/?#")
+	if end == -1 {
+		end = len(rest)
+	}
+	authority := rest[:end]
+	colon := strings.LastIndex(authority, ":")
+	if colon == -1 || colon < strings.LastIndex(authority, "]") {
+		return link
+	}
+	ports := authority[colon+1:]
+	if idx := strings.IndexAny(ports, ",-"); idx != -1 {
+		authority = authority[:colon+1] + ports[:idx]
+		return scheme + "://" + authority + rest[end:]
+	}
+	return link
+}
+
+// parseVmessLink 解析 vmess://base64(JSON) 链接
+func parseVmessLink(payload string) (*shareNode, error) {
+	encoded, _, _ := strings.Cut(payload, "#")
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		// 部分客户端导出 vmess://uuid@host:port?... 形式
+		return parseURLLink("vmess://" + payload)
+	}
+	var v struct {
+		Ps   string      `json:"ps"`
+		Add  string      `json:"add"`
+		Port json.Number `json:"port"`
+		Net  string      `json:"net"`
+		Host string      `json:"host"`
+		Path string      `json:"path"`
+		TLS  string      `json:"tls"`
+		SNI  string      `json:"sni"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return nil, fmt.Errorf("JSON无效: %w", err)
+	}
+	port, err := strconv.Atoi(strings.TrimSpace(v.Port.String()))
+	if err != nil {
+		return nil, fmt.Errorf("端口无效: %s", v.Port)
+	}
+	return &shareNode{
+		server:   v.Add,
+		port:     port,
+		name:     v.Ps,
+		sni:      v.SNI,
+		host:     v.Host,
+		path:     v.Path,
+		network:  v.Net,
+		security: v.TLS,
+	}, nil
+}
+
+// parseSSLink 解析 ss:// 链接，支持 SIP002 和旧版全 base64 格式
+func parseSSLink(rest string) (*shareNode, error) {
+	rest, name, _ := strings.Cut(rest, "#")
+	name, _ = url.PathUnescape(name)
+	// 旧版: ss://base64(method:password@host:port)
+	if !strings.Contains(rest, "@") {
+		data, err := decodeBase64(strings.TrimSuffix(rest, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("base64无效: %w", err)
+		}
+		rest = string(data)
+	}
+	at := strings.LastIndex(rest, "@")
+	if at == -1 {
+		return nil, fmt.Errorf("缺少服务器地址")
+	}
+	hostPort, query, _ := strings.Cut(rest[at+1:], "?")
+	hostPort = strings.TrimSuffix(hostPort, "/")
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("端口无效: %s", portStr)
+	}
+	node := &shareNode{server: host, port: port, name: name}
+	// SIP002 插件参数，如 plugin=v2ray-plugin;tls;host=example.com;path=/ws
+	if values, err := url.ParseQuery(query); err == nil {
+		for _, opt := range strings.Split(values.Get("plugin"), ";") {
+			key, value, _ := strings.Cut(opt, "=")
+			switch key {
+			case "host":
+				node.host = value
+				node.sni = value
+			case "path":
+				node.path = value
+			case "mode":
+				node.network = value
+			case "tls":
+				node.security = "tls"
+			}
+		}
+	}
+	return node, nil
+}
+
+// decodeBase64 兼容标准/URL安全、有无填充的 base64
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	s = strings.NewReplacer("\r", "", "\n", "", " ", "").Replace(s)
+	s = strings.TrimRight(s, "=")
+	if data, err := base64.RawStdEncoding.DecodeString(s); err == nil {
+		return data, nil
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// decodeSubscription 判断内容是否为 base64 编码的订阅，是则返回解码后的内容
+func decodeSubscription(content []byte) ([]byte, bool) {
+	trimmed := bytes.TrimSpace(content)
+	if len(trimmed) == 0 || bytes.Contains(trimmed, []byte("://")) {
+		return nil, false
+	}
+	data, err := decodeBase64(string(trimmed))
+	if err != nil || !bytes.Contains(data, []byte("://")) {
+		return nil, false
+	}
+	return data, true
+}
+
+// looksLikeBase64 判断内容开头是否全部由 base64 字符组成
+func looksLikeBase64(head []byte) bool {
+	head = bytes.TrimSpace(head)
+	if len(head) < 16 {
+		return false
+	}
+	for _, c := range head {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '+', c == '/', c == '-', c == '_', c == '=', c == '\r', c == '\n':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestParseShareLink(t *testing.T) {
+	vmessJSON := `{"v":"2","ps":"香港 01","add":"104.16.1.2","port":"2053","id":"a3482e88-686a-4a58-8126-99c9df64b7bf","net":"ws","host":"cdn.example.com","path":"/ws","tls":"tls","sni":"sni.example.com"}`
+	vmessNumber := `{"ps":"num","add":"example.com","port":8443,"net":"grpc","path":"svc"}`
+	tests := []struct {
+		name    string
+		link    string
+		want    shareNode
+		wantErr bool
+	}{
+		{
+			name: "vmess base64 json",
+			link: "vmess://" + base64.StdEncoding.EncodeToString([]byte(vmessJSON)),
+			want: shareNode{scheme: "vmess", server: "104.16.1.2", port: 2053, name: "香港 01", sni: "sni.example.com",
+				host: "cdn.example.com", path: "/ws", network: "ws", security: "tls"},
+		},
+		{
+			name: "vmess url-safe base64 without padding and numeric port",
+			link: "vmess://" + base64.RawURLEncoding.EncodeToString([]byte(vmessNumber)),
+			want: shareNode{scheme: "vmess", server: "example.com", port: 8443, name: "num", path: "svc", network: "grpc"},
+		},
+		{
+			name: "vmess url form",
+			link: "vmess://a3482e88-686a-4a58-8126-99c9df64b7bf@104.16.1.2:443?type=ws&security=tls&host=h.example.com#node",
+			want: shareNode{scheme: "vmess", server: "104.16.1.2", port: 443, name: "node", host: "h.example.com",
+				network: "ws", security: "tls"},
+		},
+		{
+			name: "ss sip002 with base64 userinfo and plugin",
+			link: "ss://" + base64.RawURLEncoding.EncodeToString([]byte("aes-256-gcm:pass")) +
+				"@104.16.1.2:8443/?plugin=v2ray-plugin%3Btls%3Bhost%3Dws.example.com%3Bpath%3D%2Fws#%E8%8A%82%E7%82%B9%201",
+			want: shareNode{scheme: "ss", server: "104.16.1.2", port: 8443, name: "节点 1", sni: "ws.example.com",
+				host: "ws.example.com", path: "/ws", security: "tls"},
+		},
+		{
+			name: "ss sip002 plain userinfo with ipv6",
+			link: "ss://2022-blake3-aes-128-gcm:cGFzcw==@[2606:4700::1]:443#v6",
+			want: shareNode{scheme: "ss", server: "2606:4700::1", port: 443, name: "v6"},
+		},
+		{
+			name: "ss legacy full base64",
+			link: "ss://" + base64.StdEncoding.EncodeToString([]byte("chacha20-ietf-poly1305:p@ss@1.2.3.4:8388")) + "#legacy",
+			want: shareNode{scheme: "ss", server: "1.2.3.4", port: 8388, name: "legacy"},
+		},
+		{
+			name: "vless reality",
+			link: "vless://uuid@1.2.3.4:443?type=tcp&security=reality&sni=www.example.com#%E5%90%8D",
+			want: shareNode{scheme: "vless", server: "1.2.3.4", port: 443, name: "名", sni: "www.example.com",
+				network: "tcp", security: "reality"},
+		},
+		{
+			name: "trojan with peer and default port",
+			link: "trojan://password@example.com?peer=peer.example.com&type=grpc&serviceName=svc",
+			want: shareNode{scheme: "trojan", server: "example.com", port: 443, sni: "peer.example.com",
+				path: "svc", network: "grpc"},
+		},
+		{
+			name: "hy2 port hopping",
+			link: "hy2://auth@[2606:4700::2]:20000-20010,30000/?sni=hy.example.com#hop",
+			want: shareNode{scheme: "hysteria2", server: "2606:4700::2", port: 20000, name: "hop", sni: "hy.example.com"},
+		},
+		{name: "vmess invalid json", link: "vmess://" + base64.StdEncoding.EncodeToString([]byte("{")), wantErr: true},
+		{name: "ss without port", link: "ss://YWVzLTI1Ni1nY206cGFzcw@1.2.3.4#x", wantErr: true},
+		{name: "vless without server", link: "vless://uuid@:443", wantErr: true},
+		{name: "trojan bad port", link: "trojan://p@1.2.3.4:70000", wantErr: true},
+		{name: "not a link", link: "1.2.3.4:443", wantErr: true},
+	}
+	for _, tt := range tests {
+		node, err := parseShareLink(tt.link)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: parseShareLink() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		tt.want.link = tt.link
+		if *node != tt.want {
+			t.Errorf("%s: parseShareLink() = %+v, want %+v", tt.name, *node, tt.want)
+		}
+	}
+
+	if _, err := parseShareLink("socks5://1.2.3.4:1080"); !errors.Is(err, errUnsupportedScheme) {
+		t.Errorf("socks5 link error = %v, want errUnsupportedScheme", err)
+	}
+}
+
+func TestShareNodeTarget(t *testing.T) {
+	node, err := parseShareLink("vless://uuid@104.16.1.2:2053?type=ws&security=tls&sni=s.example.com&host=h.example.com&path=%2Fp#tag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := node.target()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.String() != "104.16.1.2:2053" || target.SNI != "s.example.com" || target.Tag != "tag" {
+		t.Errorf("target = %s sni %q tag %q", target, target.SNI, target.Tag)
+	}
+	for key, want := range map[string]string{"proto": "vless", "host": "h.example.com", "path": "/p", "type": "ws", "security": "tls"} {
+		if got := target.meta(key); got != want {
+			t.Errorf("meta(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestDecodeSubscription(t *testing.T) {
+	links := "vmess://abc\nss://def\n"
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		ok      bool
+	}{
+		{"standard", base64.StdEncoding.EncodeToString([]byte(links)), links, true},
+		{"url-safe without padding", base64.RawURLEncoding.EncodeToString([]byte(links + "?")), links + "?", true},
+		{"wrapped lines", wrapLines(base64.StdEncoding.EncodeToString([]byte(links)), 8), links, true},
+		{"plain links", links, "", false},
+		{"base64 without links", base64.StdEncoding.EncodeToString([]byte("1.1.1.1\n2.2.2.2\n")), "", false},
+		{"empty", "  \n", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := decodeSubscription([]byte(tt.content))
+		if ok != tt.ok || string(got) != tt.want {
+			t.Errorf("%s: decodeSubscription() = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// wrapLines 每 n 个字符插入一个换行
+func wrapLines(s string, n int) string {
+	var out []byte
+	for i := 0; i < len(s); i += n {
+		end := min(i+n, len(s))
+		out = append(out, s[i:end]...)
+		out = append(out, '\n')
+	}
+	return string(out)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Target 一个待测试的目标。地址和端口使用 netip.AddrPort 表示，IPv4 映射的 IPv6 地址统一转换为 IPv4，
+// 因此同一地址的不同写法可以正确去重；主机为域名且尚未解析时 AddrPort 中的地址无效，只有端口有效
+type Target struct {
+	AddrPort netip.AddrPort
+	Hostname string     // 域名：未解析时为待解析的域名，解析后为解析出该地址的域名
+	SNI      string     // TLS SNI
+	Source   string     // 来源文件或地址
+	Tag      string     // 标签，如分享链接中的节点名称
+	Meta     url.Values // 其他附加信息，如分享链接参数、重测模式下的上次结果
+}
+
+// newTarget 由主机（IP 或域名，IPv6 可带方括号）和端口创建目标
+func newTarget(host string, port int) (Target, error) {
+	host = strings.Trim(strings.TrimSpace(host), "[]")
+	if port <= 0 || port >= 65536 {
+		return Target{}, fmt.Errorf("端口无效: %d", port)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return Target{AddrPort: netip.AddrPortFrom(addr.Unmap(), uint16(port))}, nil
+	}
+	if !validHostname(host) {
+		return Target{}, fmt.Errorf("主机无效: %s", host)
+	}
+	return Target{
+		AddrPort: netip.AddrPortFrom(netip.Addr{}, uint16(port)),
+		Hostname: strings.ToLower(strings.TrimSuffix(host, ".")),
+	}, nil
+}
+
+// addrTarget 由已解析的地址和端口创建目标
+func addrTarget(addr netip.Addr, port int) Target {
+	return Target{AddrPort: netip.AddrPortFrom(addr.Unmap(), uint16(port))}
+}
+
+// validHostname 判断是否为合法的域名（字母、数字、连字符和点，至少包含一个字母）
+func validHostname(host string) bool {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	hasLetter := false
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+				hasLetter = true
+			case c >= '0' && c <= '9', c == '-':
+			default:
+				return false
+			}
+		}
+	}
+	return hasLetter
+}
+
+// Resolved 判断目标是否已有IP地址
+func (t Target) Resolved() bool {
+	return t.AddrPort.Addr().IsValid()
+}
+
+// Port 返回目标端口
+func (t Target) Port() int {
+	return int(t.AddrPort.Port())
+}
+
+// Host 返回用于连接的主机：已解析时为IP地址（IPv6 不带方括号），否则为域名
+func (t Target) Host() string {
+	if t.Resolved() {
+		return t.AddrPort.Addr().String()
+	}
+	return t.Hostname
+}
+
+// IP 返回用于输出的主机，IPv6 使用规范的方括号形式
+func (t Target) IP() string {
+	if t.Resolved() && t.AddrPort.Addr().Is6() {
+		return "[" + t.AddrPort.Addr().String() + "]"
+	}
+	return t.Host()
+}
+
+// Key 返回用于去重的键，只包含地址（或域名）和端口
+func (t Target) Key() string {
+	return t.String()
+}
+
+// String 返回 "IP:端口"，IPv6 为 "[IPv6]:端口"
+func (t Target) String() string {
+	if t.Resolved() {
+		return t.AddrPort.String()
+	}
+	return net.JoinHostPort(t.Hostname, strconv.Itoa(t.Port()))
+}
+
+// withPort 返回替换端口后的目标
+func (t Target) withPort(port int) Target {
+	t.AddrPort = netip.AddrPortFrom(t.AddrPort.Addr(), uint16(port))
+	return t
+}
+
+// withAddr 返回填入解析地址后的目标，原域名保留在 Hostname 中
+func (t Target) withAddr(addr netip.Addr) Target {
+	t.AddrPort = netip.AddrPortFrom(addr.Unmap(), t.AddrPort.Port())
+	return t
+}
+
+// meta 读取附加信息
+func (t Target) meta(key string) string {
+	return t.Meta.Get(key)
+}
+
+// setMeta 设置附加信息，值为空时忽略
+func (t *Target) setMeta(key, value string) {
+	if value == "" {
+		return
+	}
+	if t.Meta == nil {
+		t.Meta = url.Values{}
+	}
+	t.Meta.Set(key, value)
+}
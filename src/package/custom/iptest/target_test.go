@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNewTarget(t *testing.T) {
+	tests := []struct {
+		host        string
+		port        int
+		key, ip     string
+		hostForDial string
+		resolved    bool
+		wantErr     bool
+	}{
+		{host: "1.2.3.4", port: 443, key: "1.2.3.4:443", ip: "1.2.3.4", hostForDial: "1.2.3.4", resolved: true},
+		{host: " 1.2.3.4 ", port: 443, key: "1.2.3.4:443", ip: "1.2.3.4", hostForDial: "1.2.3.4", resolved: true},
+		{host: "::ffff:1.2.3.4", port: 443, key: "1.2.3.4:443", ip: "1.2.3.4", hostForDial: "1.2.3.4", resolved: true},
+		{host: "[::ffff:1.2.3.4]", port: 443, key: "1.2.3.4:443", ip: "1.2.3.4", hostForDial: "1.2.3.4", resolved: true},
+		{host: "2606:4700::1", port: 443, key: "[2606:4700::1]:443", ip: "[2606:4700::1]", hostForDial: "2606:4700::1", resolved: true},
+		{host: "2606:4700:0:0:0:0:0:1", port: 443, key: "[2606:4700::1]:443", ip: "[2606:4700::1]", hostForDial: "2606:4700::1", resolved: true},
+		{host: "[2606:4700:0000::0001]", port: 443, key: "[2606:4700::1]:443", ip: "[2606:4700::1]", hostForDial: "2606:4700::1", resolved: true},
+		{host: "2606:4700::ABCD", port: 8443, key: "[2606:4700::abcd]:8443", ip: "[2606:4700::abcd]", hostForDial: "2606:4700::abcd", resolved: true},
+		{host: "CDN.Example.com.", port: 443, key: "cdn.example.com:443", ip: "cdn.example.com", hostForDial: "cdn.example.com"},
+		{host: "1.2.3.4", port: 0, wantErr: true},
+		{host: "1.2.3.4", port: 65536, wantErr: true},
+		{host: "1.2.3", port: 443, wantErr: true},
+		{host: "bad host", port: 443, wantErr: true},
+		{host: "", port: 443, wantErr: true},
+	}
+	for _, tt := range tests {
+		target, err := newTarget(tt.host, tt.port)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newTarget(%q, %d) error = %v, wantErr %v", tt.host, tt.port, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if target.Key() != tt.key || target.String() != tt.key || target.IP() != tt.ip ||
+			target.Host() != tt.hostForDial || target.Resolved() != tt.resolved || target.Port() != tt.port {
+			t.Errorf("newTarget(%q, %d) = key %s, String %s, IP %s, Host %s, resolved %v, port %d",
+				tt.host, tt.port, target.Key(), target.String(), target.IP(), target.Host(), target.Resolved(), target.Port())
+		}
+	}
+}
+
+// TestTargetLineFormatsDedup 同一地址的不同写法在读取后得到相同的去重键
+func TestTargetLineFormatsDedup(t *testing.T) {
+	groups := [][]string{
+		{"1.2.3.4 443", "::ffff:1.2.3.4 443", "1.2.3.4:443", "[::ffff:1.2.3.4]:443", "1.2.3.4,443"},
+		{"2606:4700::1 443", "[2606:4700::1]:443", "[2606:4700:0:0:0:0:0:1]:443", "2606:4700:0000::0001 443", "2606:4700::0:1 443"},
+		{"[2606:4700::abcd]:2053", "[2606:4700::ABCD]:2053", "2606:4700:0::AbCd 2053"},
+	}
+	for _, lines := range groups {
+		keys := make(map[string]bool)
+		count, err := readIPsFromReader("ip.txt", strings.NewReader(strings.Join(lines, "\n")), func(target Target) {
+			keys[target.Key()] = true
+		})
+		if err != nil || count != len(lines) || len(keys) != 1 {
+			t.Errorf("%q: read %d targets, err %v, keys %v, want %d targets with one key", lines, count, err, keys, len(lines))
+		}
+	}
+}
+
+func TestTargetWith(t *testing.T) {
+	base, err := newTarget("cdn.example.com", 443)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base.SNI, base.Source, base.Tag = "sni.example.com", "nodes.txt", "香港 01"
+	base.setMeta("path", "/ws")
+	base.setMeta("host", "")
+
+	check := func(name string, got Target, key, ip string) {
+		t.Helper()
+		if got.Hostname != "cdn.example.com" || got.SNI != base.SNI || got.Source != base.Source || got.Tag != base.Tag ||
+			got.meta("path") != "/ws" || got.Meta.Has("host") {
+			t.Errorf("%s lost fields: %+v", name, got)
+		}
+		if got.Key() != key || got.IP() != ip {
+			t.Errorf("%s = %s (%s), want %s (%s)", name, got.Key(), got.IP(), key, ip)
+		}
+	}
+	check("withPort", base.withPort(2053), "cdn.example.com:2053", "cdn.example.com")
+	v6 := base.withAddr(netip.MustParseAddr("2606:4700::1"))
+	check("withAddr", v6, "[2606:4700::1]:443", "[2606:4700::1]")
+	check("withAddr(mapped)", base.withAddr(netip.MustParseAddr("::ffff:104.16.1.2")), "104.16.1.2:443", "104.16.1.2")
+	check("withAddr+withPort", v6.withPort(8443), "[2606:4700::1]:8443", "[2606:4700::1]")
+	if base.Resolved() || base.Key() != "cdn.example.com:443" {
+		t.Errorf("withPort/withAddr modified the original target: %+v", base)
+	}
+	if _, ok := (Target{}).Meta["path"]; ok || (Target{Meta: url.Values{}}).meta("x") != "" {
+		t.Error("meta on an empty target")
+	}
+}
+
+func TestValidHostname(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"example.com", true},
+		{"cdn-1.example.com.", true},
+		{"_acme.example.com", true},
+		{"localhost", true},
+		{"1.2.3.4", false},
+		{"-a.example.com", false},
+		{"a-.example.com", false},
+		{"a..example.com", false},
+		{"ex ample.com", false},
+		{"例子.com", false},
+		{strings.Repeat("a", 64) + ".com", false},
+		{strings.Repeat("a.", 127) + "com", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := validHostname(tt.host); got != tt.want {
+			t.Errorf("validHostname(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// traceInfo /cdn-cgi/trace 返回的字段及 CF-RAY 响应头中的数据中心
+type traceInfo struct {
+	fields  map[string]string // trace 的全部键值
+	rayColo string            // CF-RAY 响应头后缀中的数据中心，如 8c1d2e3f4a5b6c7d-HKG 中的 HKG
+}
+
+// get 返回 trace 字段
+func (t traceInfo) get(key string) string {
+	return t.fields[key]
+}
+
+// coloMismatch 判断 trace 中的 colo 与 CF-RAY 中的数据中心是否不一致，任一为空时视为一致
+func (t traceInfo) coloMismatch() bool {
+	colo := t.get("colo")
+	return colo != "" && t.rayColo != "" && colo != t.rayColo
+}
+
+// traceColumn 可输出到结果文件的 trace 字段
+type traceColumn struct {
+	key    string // trace 字段名，ray 表示 CF-RAY 中的数据中心
+	header string // 输出列名
+}
+
+// traceColumns 可通过 -trace 输出的列，按输出顺序排列
+var traceColumns = []traceColumn{
+	{"ip", "出口IP"},
+	{"loc", "出口地区"},
+	{"tls", "TLS版本"},
+	{"http", "HTTP版本"},
+	{"sni", "SNI"},
+	{"warp", "WARP"},
+	{"visit_scheme", "访问协议"},
+	{"fl", "fl"},
+	{"ray", "CF-RAY数据中心"},
+}
+
+// parseTrace 将 trace 响应体解析为键值表，每行一个 key=value
+func parseTrace(body string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(body, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok && key != "" {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// cfRayColo 返回 CF-RAY 响应头中 - 之后的数据中心代码
+func cfRayColo(ray string) string {
+	if idx := strings.LastIndex(ray, "-"); idx != -1 {
+		return strings.ToUpper(strings.TrimSpace(ray[idx+1:]))
+	}
+	return ""
+}
+
+// selectedTraceColumns 解析 -trace 指定的输出列：all 表示全部，或逗号分隔的字段名
+func selectedTraceColumns(spec string) ([]traceColumn, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	if spec == "all" {
+		return traceColumns, nil
+	}
+	var cols []traceColumn
+	for _, key := range strings.Split(spec, ",") {
+		key = strings.TrimSpace(key)
+		found := false
+		for _, c := range traceColumns {
+			if c.key == key {
+				cols = append(cols, c)
+				found = true
+				break
+			}
+		}
+		if !found && key != "" {
+			names := make([]string, len(traceColumns))
+			for i, c := range traceColumns {
+				names[i] = c.key
+			}
+			return nil, fmt.Errorf("不支持的trace字段: %s，可选 %s 或 all", key, strings.Join(names, "、"))
+		}
+	}
+	return cols, nil
+}
+
+// value 返回结果中该列的值
+func (c traceColumn) value(t traceInfo) string {
+	if c.key == "ray" {
+		return t.rayColo
+	}
+	return t.get(c.key)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestParseTrace(t *testing.T) {
+	tests := []struct {
+		body string
+		want map[string]string
+	}{
+		{
+			body: "fl=123f45\nh=104.16.1.2\nip=203.0.113.7\nts=1700000000.123\nvisit_scheme=https\nuag=Mozilla/5.0\ncolo=HKG\nsliver=none\nhttp=http/1.1\nloc=HK\ntls=TLSv1.3\nsni=plaintext\nwarp=off\ngateway=off\nrbi=off\nkex=X25519\n",
+			want: map[string]string{
+				"fl": "123f45", "h": "104.16.1.2", "ip": "203.0.113.7", "ts": "1700000000.123", "visit_scheme": "https",
+				"uag": "Mozilla/5.0", "colo": "HKG", "sliver": "none", "http": "http/1.1", "loc": "HK",
+				"tls": "TLSv1.3", "sni": "plaintext", "warp": "off", "gateway": "off", "rbi": "off", "kex": "X25519",
+			},
+		},
+		{
+			// CRLF、空行、值中含 =、缺少 = 和空键
+			body: "ip=2001:db8::7\r\n\r\nuag=a=b\r\nnot a field\r\n=orphan\r\ncolo=\r\n",
+			want: map[string]string{"ip": "2001:db8::7", "uag": "a=b", "colo": ""},
+		},
+		{body: "", want: map[string]string{}},
+		{body: "<html>error</html>", want: map[string]string{}},
+	}
+	for _, tt := range tests {
+		if got := parseTrace(tt.body); !maps.Equal(got, tt.want) {
+			t.Errorf("parseTrace(%q) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestCFRayColo(t *testing.T) {
+	tests := []struct {
+		ray  string
+		want string
+	}{
+		{"8c1d2e3f4a5b6c7d-HKG", "HKG"},
+		{"8c1d2e3f4a5b6c7d-nrt ", "NRT"},
+		{"8c1d2e3f4a5b6c7d", ""},
+		{"", ""},
+		{"a-b-LAX", "LAX"},
+	}
+	for _, tt := range tests {
+		if got := cfRayColo(tt.ray); got != tt.want {
+			t.Errorf("cfRayColo(%q) = %q, want %q", tt.ray, got, tt.want)
+		}
+	}
+}
+
+func TestColoMismatch(t *testing.T) {
+	tests := []struct {
+		colo, ray string
+		want      bool
+	}{
+		{"HKG", "HKG", false},
+		{"HKG", "NRT", true},
+		{"", "NRT", false},
+		{"HKG", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		trace := traceInfo{fields: map[string]string{"colo": tt.colo}, rayColo: tt.ray}
+		if got := trace.coloMismatch(); got != tt.want {
+			t.Errorf("coloMismatch(colo=%q, ray=%q) = %v, want %v", tt.colo, tt.ray, got, tt.want)
+		}
+	}
+}
+
+func TestSelectedTraceColumns(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{spec: "", want: nil},
+		{spec: " all ", want: []string{"ip", "loc", "tls", "http", "sni", "warp", "visit_scheme", "fl", "ray"}},
+		{spec: "ray, ip,,loc", want: []string{"ray", "ip", "loc"}},
+		{spec: "ip,colo", wantErr: true},
+	}
+	for _, tt := range tests {
+		cols, err := selectedTraceColumns(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("selectedTraceColumns(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		var keys []string
+		for _, c := range cols {
+			keys = append(keys, c.key)
+		}
+		if !slices.Equal(keys, tt.want) {
+			t.Errorf("selectedTraceColumns(%q) = %v, want %v", tt.spec, keys, tt.want)
+		}
+	}
+
+	trace := traceInfo{fields: map[string]string{"ip": "203.0.113.7"}, rayColo: "HKG"}
+	if got := (traceColumn{key: "ray"}).value(trace); got != "HKG" {
+		t.Errorf("ray column value = %q", got)
+	}
+	if got := (traceColumn{key: "ip"}).value(trace); got != "203.0.113.7" {
+		t.Errorf("ip column value = %q", got)
+	}
+}
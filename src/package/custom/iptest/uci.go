@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// uciApps 可导入节点的 OpenWrt 代理插件，对应 /etc/config 下的同名文件
+var uciApps = []string{"passwall", "passwall2", "shadowsocksr", "homeproxy"}
+
+// uciNodePattern 匹配 UCI 配置中保存节点的段：passwall/passwall2 的 nodes、ssr-plus 的 servers、homeproxy 的 node
+var uciNodePattern = regexp.MustCompile(`(?m)^\s*config\s+(nodes|servers|node)(\s|$)`)
+
+// uciSectionPattern 匹配任意 UCI 段的开头，用于在文件开头识别 UCI 配置。
+// passwall 等配置在第一个节点之前常有数 KB 的 global、shunt_rules 等段，不能只在开头查找节点段
+var uciSectionPattern = regexp.MustCompile(`(?m)^\s*config\s+\w+(\s|$)`)
+
+// uciSources -uci 导入的插件配置文件，读取时整个文件按 UCI 解析
+var uciSources = make(map[string]bool)
+
+// uciSection UCI 配置中的一个段（config 类型 '名称'），list 选项保留全部取值
+type uciSection struct {
+	typ     string
+	name    string
+	options map[string][]string
+}
+
+// get 返回第一个非空选项的值
+func (s *uciSection) get(keys ...string) string {
+	for _, key := range keys {
+		if values := s.options[key]; len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// enabled 判断布尔选项是否开启
+func (s *uciSection) enabled(key string) bool {
+	switch s.get(key) {
+	case "1", "true", "on", "yes", "enabled":
+		return true
+	}
+	return false
+}
+
+// uciSourcePaths 返回 -ucidir 下存在的插件配置文件
+func uciSourcePaths() []string {
+	var paths []string
+	for _, app := range uciApps {
+		path := filepath.Join(*uciDir, app)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// applyUCISources 处理 -uci：将找到的插件配置加入 -path，未指定 -path 时只读取这些配置
+func applyUCISources() error {
+	if !*uciImport {
+		return nil
+	}
+	paths := uciSourcePaths()
+	if len(paths) == 0 {
+		return fmt.Errorf("%s 下未找到 %s 配置", *uciDir, strings.Join(uciApps, "、"))
+	}
+	fmt.Printf("从UCI配置导入节点: %s\n", strings.Join(paths, ", "))
+	for _, path := range paths {
+		uciSources[path] = true
+	}
+	if !flagSet("path") || *Path == "" {
+		*Path = strings.Join(paths, ",")
+	} else {
+		*Path += "," + strings.Join(paths, ",")
+	}
+	return nil
+}
+
+// parseUCI 解析 UCI 配置文件，不依赖 uci 命令
+func parseUCI(content []byte) []*uciSection {
+	var sections []*uciSection
+	var cur *uciSection
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		tokens := uciTokens(scanner.Text())
+		if len(tokens) == 0 {
+			continue
+		}
+		switch tokens[0] {
+		case "config":
+			if len(tokens) < 2 {
+				cur = nil
+				continue
+			}
+			cur = &uciSection{typ: tokens[1], options: make(map[string][]string)}
+			if len(tokens) > 2 {
+				cur.name = tokens[2]
+			}
+			sections = append(sections, cur)
+		case "option":
+			if cur != nil && len(tokens) > 2 {
+				cur.options[tokens[1]] = []string{tokens[2]}
+			}
+		case "list":
+			if cur != nil && len(tokens) > 2 {
+				cur.options[tokens[1]] = append(cur.options[tokens[1]], tokens[2])
+			}
+		}
+	}
+	return sections
+}
+
+// uciTokens 按 UCI 语法拆分一行：支持单引号、双引号、反斜杠转义和相邻的片段拼接为同一个值，# 之后为注释
+func uciTokens(line string) []string {
+	var tokens []string
+	var cur strings.Builder
+	inToken := false
+	var quote rune
+	escaped := false
+	for _, c := range line {
+		switch {
+		case escaped:
+			cur.WriteRune(c)
+			escaped = false
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				escaped = true
+			} else {
+				cur.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inToken = true
+		case c == '\\':
+			escaped = true
+			inToken = true
+		case c == '#':
+			if inToken {
+				tokens = append(tokens, cur.String())
+			}
+			return tokens
+		case c == ' ' || c == '\t':
+			if inToken {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+				inToken = false
+			}
+		default:
+			cur.WriteRune(c)
+			inToken = true
+		}
+	}
+	if inToken {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens
+}
+
+// parseUCIConfig 识别 passwall、passwall2、ssr-plus（shadowsocksr）和 homeproxy 的 UCI 配置，
+// 将每个节点的地址和端口转换为以节点名称为标签的目标。分流、负载均衡等没有地址的节点被忽略
+func parseUCIConfig(filePath string, content []byte) (targets []Target, format string, ok bool) {
+	if !uciNodePattern.Match(content) {
+		return nil, "", false
+	}
+	for _, s := range parseUCI(content) {
+		var node *shareNode
+		switch s.typ {
+		case "nodes":
+			format = "passwall"
+			if filepath.Base(filePath) == "passwall2" {
+				format = "passwall2"
+			}
+			node = passwallNode(s)
+		case "servers":
+			format = "ssr-plus"
+			node = ssrPlusNode(s)
+		case "node":
+			format = "homeproxy"
+			node = homeproxyNode(s)
+		}
+		if node != nil {
+			targets = appendNodeTarget(targets, node)
+		}
+	}
+	return targets, format + " UCI", true
+}
+
+// uciPort 解析端口选项，无效时返回 0
+func uciPort(s string) int {
+	port, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || port <= 0 || port >= 65536 {
+		return 0
+	}
+	return port
+}
+
+// uciSecurity 根据 tls/reality 开关返回 tls、reality 或空
+func uciSecurity(s *uciSection, tlsKey, realityKey string) string {
+	switch {
+	case s.enabled(realityKey):
+		return "reality"
+	case s.enabled(tlsKey):
+		return "tls"
+	}
+	return ""
+}
+
+// passwallNode 将 passwall/passwall2 的 nodes 段转换为节点
+func passwallNode(s *uciSection) *shareNode {
+	node := &shareNode{
+		scheme:   strings.ToLower(firstNonEmpty(s.get("protocol"), s.get("type"))),
+		name:     firstNonEmpty(s.get("remarks"), s.name),
+		server:   s.get("address"),
+		port:     uciPort(s.get("port")),
+		sni:      s.get("tls_serverName"),
+		network:  s.get("transport"),
+		security: uciSecurity(s, "tls", "reality"),
+		host:     s.get("ws_host", "h2_host", "httpupgrade_host", "xhttp_host", "splithttp_host"),
+		path:     s.get("ws_path", "h2_path", "httpupgrade_path", "xhttp_path", "splithttp_path", "grpc_serviceName"),
+	}
+	if node.server == "" || node.port == 0 {
+		return nil
+	}
+	return node
+}
+
+// ssrPlusNode 将 ssr-plus 的 servers 段转换为节点
+func ssrPlusNode(s *uciSection) *shareNode {
+	node := &shareNode{
+		scheme:   strings.ToLower(firstNonEmpty(s.get("v2ray_protocol"), s.get("type"))),
+		name:     firstNonEmpty(s.get("alias"), s.name),
+		server:   s.get("server"),
+		port:     uciPort(s.get("server_port")),
+		sni:      s.get("tls_host"),
+		network:  s.get("transport"),
+		security: uciSecurity(s, "tls", "reality"),
+		host:     s.get("ws_host", "h2_host", "httpupgrade_host", "xhttp_host"),
+		path:     s.get("ws_path", "h2_path", "httpupgrade_path", "xhttp_path", "serviceName"),
+	}
+	if node.server == "" || node.port == 0 {
+		return nil
+	}
+	return node
+}
+
+// homeproxyNode 将 homeproxy 的 node 段转换为节点
+func homeproxyNode(s *uciSection) *shareNode {
+	node := &shareNode{
+		scheme:   strings.ToLower(s.get("type")),
+		name:     firstNonEmpty(s.get("label"), s.name),
+		server:   s.get("address"),
+		port:     uciPort(s.get("port")),
+		sni:      s.get("tls_sni"),
+		network:  s.get("transport"),
+		security: uciSecurity(s, "tls", "tls_reality"),
+		host:     s.get("ws_host", "http_host", "httpupgrade_host"),
+		path:     s.get("ws_path", "http_path", "httpupgrade_path", "grpc_servicename"),
+	}
+	if node.server == "" || node.port == 0 {
+		return nil
+	}
+	return node
+}
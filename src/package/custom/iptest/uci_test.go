@@ -0,0 +1,177 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestUCITokens(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"\toption address '1.2.3.4'", []string{"option", "address", "1.2.3.4"}},
+		{`option remarks "香港 01"`, []string{"option", "remarks", "香港 01"}},
+		{`option remarks 'it'\''s'`, []string{"option", "remarks", "it's"}},
+		{`option path "/a\"b"`, []string{"option", "path", `/a"b`}},
+		{`option path '/a\b'`, []string{"option", "path", `/a\b`}},
+		{"option name a'b c'd", []string{"option", "name", "ab cd"}},
+		{"option port 443 # 注释", []string{"option", "port", "443"}},
+		{"option remarks '# 不是注释'", []string{"option", "remarks", "# 不是注释"}},
+		{"option empty ''", []string{"option", "empty", ""}},
+		{"# config nodes", nil},
+		{"   ", nil},
+	}
+	for _, tt := range tests {
+		if got := uciTokens(tt.line); !slices.Equal(got, tt.want) {
+			t.Errorf("uciTokens(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseUCI(t *testing.T) {
+	content := "config global\n" +
+		"\toption enabled '1'\n" +
+		"option orphan 'x'\n" +
+		"config nodes 'hk'\n" +
+		"\toption port '443'\n" +
+		"\toption port '8443'\n" +
+		"\tlist alpn 'h2'\n" +
+		"\tlist alpn \"http/1.1\"\n" +
+		"config\n" +
+		"\toption lost '1'\n"
+	sections := parseUCI([]byte(content))
+	if len(sections) != 2 {
+		t.Fatalf("parseUCI() returned %d sections, want 2", len(sections))
+	}
+	if s := sections[0]; s.typ != "global" || s.name != "" || !s.enabled("enabled") || s.get("orphan") != "x" {
+		t.Errorf("section 0 = %+v", s)
+	}
+	s := sections[1]
+	if s.typ != "nodes" || s.name != "hk" {
+		t.Errorf("section 1 = %s %s", s.typ, s.name)
+	}
+	// option 重复时后者覆盖前者，list 保留全部取值
+	if got := s.options["port"]; !slices.Equal(got, []string{"8443"}) {
+		t.Errorf("port = %q", got)
+	}
+	if got := s.options["alpn"]; !slices.Equal(got, []string{"h2", "http/1.1"}) {
+		t.Errorf("alpn = %q", got)
+	}
+	if s.get("missing", "alpn") != "h2" {
+		t.Errorf("get() did not fall back to the first list value")
+	}
+}
+
+func TestParseUCIConfig(t *testing.T) {
+	tests := []struct {
+		fixture string
+		path    string
+		format  string
+		want    []configTarget
+	}{
+		{
+			fixture: "passwall.uci",
+			path:    "/etc/config/passwall",
+			format:  "passwall UCI",
+			want: []configTarget{
+				{"cdn.example.com:443", "sni.example.com", "香港 01", "ws.example.com", "/ws?ed=2048", "ws", "tls"},
+				{"[2606:4700::1]:8443", "www.example.com", "it's reality", "", "svc", "grpc", "reality"},
+				{"1.2.3.4:8388", "", "ss", "", "", "", ""},
+			},
+		},
+		{
+			fixture: "passwall.uci",
+			path:    "/etc/config/passwall2",
+			format:  "passwall2 UCI",
+			want: []configTarget{
+				{"cdn.example.com:443", "sni.example.com", "香港 01", "ws.example.com", "/ws?ed=2048", "ws", "tls"},
+				{"[2606:4700::1]:8443", "www.example.com", "it's reality", "", "svc", "grpc", "reality"},
+				{"1.2.3.4:8388", "", "ss", "", "", "", ""},
+			},
+		},
+		{
+			fixture: "ssr-plus.uci",
+			path:    "/etc/config/shadowsocksr",
+			format:  "ssr-plus UCI",
+			want: []configTarget{
+				{"104.16.1.2:2053", "tr.example.com", "ssr plus 节点", "h.example.com", "/tr", "ws", "tls"},
+				{"5.6.7.8:443", "", "cfg084a8f", "", "", "", ""},
+			},
+		},
+		{
+			fixture: "homeproxy.uci",
+			path:    "/etc/config/homeproxy",
+			format:  "homeproxy UCI",
+			want: []configTarget{
+				{"104.16.1.3:2083", "hp.example.com", "Home Proxy", "a.example.com", "/h", "http", "tls"},
+				{"hy.example.com:443", "hy.example.com", "hy", "", "", "", "tls"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		content, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		targets, format, ok := parseUCIConfig(tt.path, content)
+		if !ok || format != tt.format {
+			t.Errorf("%s: parseUCIConfig() format = %q, ok = %v, want %q", tt.path, format, ok, tt.format)
+			continue
+		}
+		got := configTargets(targets)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: parseUCIConfig() =\n  %+v\nwant\n  %+v", tt.path, got, tt.want)
+		}
+	}
+
+	if _, _, ok := parseUCIConfig("/etc/config/network", []byte("config interface 'lan'\n\toption proto 'static'\n")); ok {
+		t.Error("parseUCIConfig() accepted a config without node sections")
+	}
+}
+
+// TestUCILongPreamble 第一个节点段之前有超过 4KB 的 global、shunt_rules 等段时，
+// 无论通过 -uci 导入还是直接作为 -path 读取，都要解析出全部节点
+func TestUCILongPreamble(t *testing.T) {
+	content, err := os.ReadFile(filepath.Join("testdata", "passwall-long.uci"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx := strings.Index(string(content), "config nodes"); idx < 4096 {
+		t.Fatalf("fixture has only %d bytes before the first node", idx)
+	}
+	want := []configTarget{
+		{"cdn.example.com:443", "sni.example.com", "香港 01", "ws.example.com", "/ws?ed=2048", "ws", "tls"},
+		{"[2606:4700::1]:8443", "www.example.com", "it's reality", "", "svc", "grpc", "reality"},
+		{"1.2.3.4:8388", "", "ss", "", "", "", ""},
+	}
+
+	targets, format, ok := parseUCIConfig("/etc/config/passwall", content)
+	if got := configTargets(targets); !ok || format != "passwall UCI" || !slices.Equal(got, want) {
+		t.Errorf("parseUCIConfig() = %+v, %q, %v", got, format, ok)
+	}
+
+	savedImport, savedDir, savedPath, savedSources := *uciImport, *uciDir, *Path, uciSources
+	t.Cleanup(func() { *uciImport, *uciDir, *Path, uciSources = savedImport, savedDir, savedPath, savedSources })
+	*uciImport, *uciDir, *Path, uciSources = true, t.TempDir(), "", make(map[string]bool)
+	uciPath := filepath.Join(*uciDir, "passwall")
+	if err := os.WriteFile(uciPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyUCISources(); err != nil || *Path != uciPath {
+		t.Fatalf("applyUCISources() = %v, -path = %q", err, *Path)
+	}
+
+	for _, path := range []string{uciPath, filepath.Join("testdata", "passwall-long.uci")} {
+		var targets []Target
+		if _, err := readIPsFromFile(path, func(t Target) { targets = append(targets, t) }); err != nil {
+			t.Errorf("readIPsFromFile(%s) error = %v", path, err)
+		}
+		if got := configTargets(targets); !slices.Equal(got, want) {
+			t.Errorf("readIPsFromFile(%s) =\n  %+v\nwant\n  %+v", path, got, want)
+		}
+	}
+}